@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kaiiak/zaptext"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// toText converts zap JSON entries, one per line, to the text format.
+func toText(opts *options, in io.Reader, out, stderr io.Writer) error {
+	enc := zaptext.NewTextEncoderWithOptions(opts.cfg, opts.textOptions()...)
+	r := bufio.NewReader(in)
+	for n := 1; ; n++ {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			if convErr := convertJSONLine(enc, &opts.cfg, trimmed, out); convErr != nil {
+				fmt.Fprintf(stderr, "zaptext: line %d: %v\n", n, convErr)
+				if _, err := io.WriteString(out, strings.TrimSuffix(line, "\n")+"\n"); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// convertJSONLine decodes a zap JSON entry and writes it with enc.
+func convertJSONLine(enc zapcore.Encoder, cfg *zapcore.EncoderConfig, line string, out io.Writer) error {
+	ent, fields, err := decodeJSONEntry(cfg, line)
+	if err != nil {
+		return err
+	}
+	buf, err := enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+	_, err = out.Write(buf.Bytes())
+	return err
+}
+
+// toJSON converts text entries to zap JSON entries, one per line.
+func toJSON(opts *options, in io.Reader, out, stderr io.Writer) error {
+	w := newJSONWriter(opts.cfg)
+	s := zaptext.NewScanner(in, zaptext.NewParser(opts.cfg, opts.textOptions()...))
+	for n := 1; s.Scan(); n++ {
+		rec, err := s.Record()
+		if err != nil {
+			fmt.Fprintf(stderr, "zaptext: entry %d: %v\n", n, err)
+			if _, err := io.WriteString(out, s.Text()+"\n"); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.write(out, rec); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// jsonWriter writes Records with zap's JSON encoder.
+type jsonWriter struct {
+	enc zapcore.Encoder
+	// untimed omits the time key, which the JSON encoder would otherwise
+	// fill with the zero time for records without a timestamp.
+	untimed zapcore.Encoder
+}
+
+func newJSONWriter(cfg zapcore.EncoderConfig) *jsonWriter {
+	untimedCfg := cfg
+	untimedCfg.TimeKey = ""
+	return &jsonWriter{enc: zapcore.NewJSONEncoder(cfg), untimed: zapcore.NewJSONEncoder(untimedCfg)}
+}
+
+func (w *jsonWriter) write(out io.Writer, rec zaptext.Record) error {
+	ent := zapcore.Entry{
+		Level:      rec.Level,
+		Time:       rec.Time,
+		LoggerName: rec.LoggerName,
+		Message:    rec.Message,
+		Caller:     zapcore.EntryCaller{Defined: rec.Caller != "", File: rec.Caller, Function: rec.Function},
+		Stack:      rec.Stack,
+	}
+	fields := make([]zapcore.Field, len(rec.Fields))
+	for i, f := range rec.Fields {
+		fields[i] = valueField(f.Key, f.Value)
+	}
+	enc := w.enc
+	if rec.Time.IsZero() {
+		enc = w.untimed
+	}
+	buf, err := enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+	_, err = out.Write(buf.Bytes())
+	return err
+}
+
+// decodeJSONEntry decodes a line written by zap's JSON encoder configured
+// with the keys of cfg, keeping the order of the fields.
+func decodeJSONEntry(cfg *zapcore.EncoderConfig, line string) (zapcore.Entry, []zapcore.Field, error) {
+	var ent zapcore.Entry
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	v, err := decodeJSON(dec)
+	if err != nil {
+		return ent, nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return ent, nil, errors.New("trailing data after JSON object")
+	}
+	if v.Kind != zaptext.ObjectKind {
+		return ent, nil, errors.New("not a JSON object")
+	}
+
+	var fields []zapcore.Field
+	for _, f := range v.Fields {
+		header := f.Key != "" && f.Value.Kind == zaptext.StringKind
+		switch {
+		case f.Key != "" && f.Key == cfg.TimeKey && (f.Value.Kind == zaptext.StringKind || f.Value.Kind == zaptext.NumberKind):
+			if ent.Time, err = f.Value.Time(); err != nil {
+				return ent, nil, err
+			}
+		case header && f.Key == cfg.LevelKey:
+			if err := ent.Level.UnmarshalText([]byte(f.Value.Text)); err != nil {
+				return ent, nil, fmt.Errorf("unrecognized level: %q", f.Value.Text)
+			}
+		case header && f.Key == cfg.NameKey:
+			ent.LoggerName = f.Value.Text
+		case header && f.Key == cfg.CallerKey:
+			ent.Caller.Defined, ent.Caller.File = true, f.Value.Text
+		case header && f.Key == cfg.FunctionKey:
+			ent.Caller.Function = f.Value.Text
+		case header && f.Key == cfg.MessageKey:
+			ent.Message = f.Value.Text
+		case header && f.Key == cfg.StacktraceKey:
+			ent.Stack = f.Value.Text
+		default:
+			fields = append(fields, valueField(f.Key, f.Value))
+		}
+	}
+	return ent, fields, nil
+}
+
+// decodeJSON decodes the next JSON value from dec as a zaptext.Value, so that
+// both directions share the conversion to zap fields.
+func decodeJSON(dec *json.Decoder) (zaptext.Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return zaptext.Value{}, err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' {
+			v := zaptext.Value{Kind: zaptext.ArrayKind}
+			for dec.More() {
+				elem, err := decodeJSON(dec)
+				if err != nil {
+					return v, err
+				}
+				v.Elems = append(v.Elems, elem)
+			}
+			_, err := dec.Token()
+			return v, err
+		}
+		v := zaptext.Value{Kind: zaptext.ObjectKind}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return v, err
+			}
+			value, err := decodeJSON(dec)
+			if err != nil {
+				return v, err
+			}
+			v.Fields = append(v.Fields, zaptext.Field{Key: key.(string), Value: value})
+		}
+		_, err := dec.Token()
+		return v, err
+	case string:
+		return zaptext.Value{Kind: zaptext.StringKind, Text: tok}, nil
+	case json.Number:
+		return zaptext.Value{Kind: zaptext.NumberKind, Text: tok.String()}, nil
+	case bool:
+		return zaptext.Value{Kind: zaptext.BoolKind, Text: strconv.FormatBool(tok)}, nil
+	}
+	return zaptext.Value{Kind: zaptext.NullKind, Text: "null"}, nil
+}
+
+// valueField converts a decoded value to a zap field of the matching type.
+func valueField(key string, v zaptext.Value) zapcore.Field {
+	switch v.Kind {
+	case zaptext.NumberKind:
+		if n, err := v.Int(); err == nil {
+			return zap.Int64(key, n)
+		}
+		if n, err := strconv.ParseUint(v.Text, 10, 64); err == nil {
+			return zap.Uint64(key, n)
+		}
+		if f, err := v.Float(); err == nil {
+			return zap.Float64(key, f)
+		}
+	case zaptext.BoolKind:
+		return zap.Bool(key, v.Text == "true")
+	case zaptext.NullKind:
+		return zap.Reflect(key, nil)
+	case zaptext.ArrayKind:
+		return zap.Array(key, valueArray(v.Elems))
+	case zaptext.ObjectKind:
+		return zap.Object(key, valueObject(v.Fields))
+	}
+	return zap.String(key, v.Text)
+}
+
+// valueObject marshals decoded fields as a zap object.
+type valueObject []zaptext.Field
+
+func (obj valueObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, f := range obj {
+		valueField(f.Key, f.Value).AddTo(enc)
+	}
+	return nil
+}
+
+// valueArray marshals decoded values as a zap array.
+type valueArray []zaptext.Value
+
+func (arr valueArray) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, v := range arr {
+		var err error
+		switch f := valueField("", v); f.Type {
+		case zapcore.Int64Type:
+			enc.AppendInt64(f.Integer)
+		case zapcore.Uint64Type:
+			enc.AppendUint64(uint64(f.Integer))
+		case zapcore.Float64Type:
+			enc.AppendFloat64(math.Float64frombits(uint64(f.Integer)))
+		case zapcore.BoolType:
+			enc.AppendBool(f.Integer == 1)
+		case zapcore.ArrayMarshalerType:
+			err = enc.AppendArray(f.Interface.(zapcore.ArrayMarshaler))
+		case zapcore.ObjectMarshalerType:
+			err = enc.AppendObject(f.Interface.(zapcore.ObjectMarshaler))
+		case zapcore.ReflectType:
+			err = enc.AppendReflected(f.Interface)
+		default:
+			enc.AppendString(f.String)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
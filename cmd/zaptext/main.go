@@ -0,0 +1,222 @@
+// Command zaptext converts logs between zap's JSON format and the zaptext
+// text format.
+//
+// Usage:
+//
+//	zaptext totext [flags] [file ...]
+//	zaptext tojson [flags] [file ...]
+//	zaptext query [flags] [file ...]
+//
+// The commands read the named files, or standard input when there are none,
+// and write to standard output. totext and tojson convert the entries, copying
+// lines that can't be decoded unchanged and reporting them on standard error.
+// totext colors its output with -color. query writes the text entries that
+// match filters on their level, time and fields, e.g.
+//
+//	zaptext query -level warn -since 1h -where 'status>=500 && path~"^/api"' app.log
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kaiiak/zaptext"
+	"go.uber.org/zap/zapcore"
+)
+
+const usage = `usage: zaptext <command> [flags] [file ...]
+
+commands:
+  totext  convert zap JSON logs to the zaptext format
+  tojson  convert zaptext logs to zap JSON logs
+  query   filter zaptext logs by level, time and fields
+
+Run 'zaptext <command> -h' for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	var cmd func(*options, io.Reader, io.Writer, io.Writer) error
+	switch args[0] {
+	case "totext":
+		cmd = toText
+	case "tojson":
+		cmd = toJSON
+	case "query":
+		cmd = query
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "zaptext: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+
+	opts := &options{color: "never", colorOutput: stdout}
+	fs := flag.NewFlagSet("zaptext "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	opts.register(fs)
+	if args[0] == "totext" {
+		fs.StringVar(&opts.color, "color", "never", "color the output: never, auto (when writing to a terminal) or always")
+	}
+	if args[0] == "query" {
+		opts.query = &queryOptions{}
+		opts.query.register(fs)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	err := opts.init()
+	if err == nil && opts.query != nil {
+		err = opts.query.init(time.Now())
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "zaptext: %v\n", err)
+		return 2
+	}
+
+	in, closeInputs, err := openInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "zaptext: %v\n", err)
+		return 1
+	}
+	defer closeInputs()
+
+	out := bufio.NewWriter(stdout)
+	err = cmd(opts, in, out, stderr)
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "zaptext: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// openInputs returns the concatenation of the named files, or stdin when no
+// files are named.
+func openInputs(names []string, stdin io.Reader) (io.Reader, func(), error) {
+	if len(names) == 0 {
+		return stdin, func() {}, nil
+	}
+	var readers []io.Reader
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+	return io.MultiReader(readers...), closeAll, nil
+}
+
+// options holds the flags shared by the commands: the keys and encoders of
+// the zapcore.EncoderConfig and the zaptext options, which describe the
+// format being read or written.
+type options struct {
+	cfg          zapcore.EncoderConfig
+	timeEncoder  string
+	levelEncoder string
+	keyed        bool
+	logfmt       bool
+	nested       bool
+	multiline    bool
+
+	// color is the flag of the totext command, checked against colorOutput,
+	// the unbuffered standard output.
+	color       string
+	colorMode   zaptext.ColorMode
+	colorOutput io.Writer
+
+	query *queryOptions // the flags of the query command
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.cfg.TimeKey, "time-key", "ts", "key of the timestamp")
+	fs.StringVar(&o.cfg.LevelKey, "level-key", "level", "key of the level")
+	fs.StringVar(&o.cfg.NameKey, "name-key", "logger", "key of the logger name")
+	fs.StringVar(&o.cfg.CallerKey, "caller-key", "caller", "key of the caller")
+	fs.StringVar(&o.cfg.FunctionKey, "function-key", "", "key of the caller's function")
+	fs.StringVar(&o.cfg.MessageKey, "message-key", "msg", "key of the message")
+	fs.StringVar(&o.cfg.StacktraceKey, "stacktrace-key", "stacktrace", "key of the stack trace")
+	fs.StringVar(&o.timeEncoder, "time-encoder", "iso8601", "time encoder of the output: iso8601, rfc3339, rfc3339nano, millis, nanos or epoch")
+	fs.StringVar(&o.levelEncoder, "level-encoder", "capital", "level encoder of the output: capital, capitalColor, color or lowercase")
+	fs.BoolVar(&o.keyed, "keyed", false, "text format: write the level, logger name, caller and message as key=value pairs")
+	fs.BoolVar(&o.logfmt, "logfmt", false, "text format: strict logfmt")
+	fs.BoolVar(&o.nested, "nested", false, "text format: nested namespaces")
+	fs.BoolVar(&o.multiline, "multiline-stack", false, "text format: stack traces on continuation lines")
+}
+
+// init completes the EncoderConfig once the flags are parsed.
+func (o *options) init() error {
+	// zapcore's encoders fall back to epoch and lowercase on unknown names,
+	// which would hide typos.
+	switch o.timeEncoder {
+	case "iso8601", "rfc3339", "rfc3339nano", "millis", "nanos", "epoch":
+	default:
+		return fmt.Errorf("unknown time encoder %q", o.timeEncoder)
+	}
+	switch o.levelEncoder {
+	case "capital", "capitalColor", "color", "lowercase":
+	default:
+		return fmt.Errorf("unknown level encoder %q", o.levelEncoder)
+	}
+	if err := o.colorMode.UnmarshalText([]byte(o.color)); err != nil {
+		return err
+	}
+	if err := o.cfg.EncodeTime.UnmarshalText([]byte(o.timeEncoder)); err != nil {
+		return err
+	}
+	if err := o.cfg.EncodeLevel.UnmarshalText([]byte(o.levelEncoder)); err != nil {
+		return err
+	}
+	// Callers are carried over verbatim rather than reformatted.
+	o.cfg.EncodeCaller = func(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendString(caller.File)
+	}
+	o.cfg.EncodeDuration = zapcore.StringDurationEncoder
+	o.cfg.EncodeName = zapcore.FullNameEncoder
+	return nil
+}
+
+// textOptions returns the zaptext options selected by the flags.
+func (o *options) textOptions() []zaptext.Option {
+	opts := []zaptext.Option{
+		zaptext.WithStrictLogfmt(o.logfmt),
+		zaptext.WithNestedNamespaces(o.nested),
+		zaptext.WithKeyedLevel(o.keyed),
+		zaptext.WithKeyedName(o.keyed),
+		zaptext.WithKeyedCaller(o.keyed),
+		zaptext.WithKeyedMessage(o.keyed),
+		zaptext.WithColorOutput(o.colorOutput),
+		zaptext.WithColorMode(o.colorMode),
+	}
+	if o.multiline {
+		opts = append(opts, zaptext.WithStacktraceFormat(zaptext.StacktraceMultiline))
+	}
+	return opts
+}
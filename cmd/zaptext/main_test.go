@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const jsonLog = `{"level":"info","ts":1704164645.5,"logger":"db","caller":"app/main.go:3","msg":"user logged in","user":"bob smith","n":42,"ok":true,"nil":null,"tags":["a","b c",1],"obj":{"k":"v","inner":{"x":1}}}
+{"level":"error","ts":1704164646,"msg":"failed","stacktrace":"main.main\n\t/src/main.go:10"}
+`
+
+func runCommand(t *testing.T, input string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+
+	var out, errOut bytes.Buffer
+	code = run(args, strings.NewReader(input), &out, &errOut)
+	return out.String(), errOut.String(), code
+}
+
+func TestToText(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name: "Default",
+			args: []string{"totext"},
+			expected: `ts="2024-01-02T03:04:05.500Z" INFO db app/main.go:3 user logged in user="bob smith" n=42 ok=true nil=null tags=[a,"b c",1] obj={k=v inner={x=1}}` + "\n" +
+				`ts="2024-01-02T03:04:06.000Z" ERROR failed stacktrace="main.main\n\t/src/main.go:10"` + "\n",
+		},
+		{
+			name: "Logfmt",
+			args: []string{"totext", "-logfmt", "-level-encoder", "lowercase", "-time-encoder", "rfc3339"},
+			expected: `ts=2024-01-02T03:04:05Z level=info logger=db caller=app/main.go:3 msg="user logged in" user="bob smith" n=42 ok=true nil=null tags="[a,\"b c\",1]" obj="{k=v inner={x=1}}"` + "\n" +
+				`ts=2024-01-02T03:04:06Z level=error msg=failed stacktrace="main.main\n\t/src/main.go:10"` + "\n",
+		},
+		{
+			name:     "Multiline stacks",
+			args:     []string{"totext", "-multiline-stack", "-time-key", "", "-caller-key", ""},
+			expected: `INFO db user logged in ts=1704164645.5 caller="app/main.go:3" user="bob smith" n=42 ok=true nil=null tags=[a,"b c",1] obj={k=v inner={x=1}}` + "\nERROR failed ts=1704164646\n\tmain.main\n\t\t/src/main.go:10\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, code := runCommand(t, jsonLog, tt.args...)
+			if code != 0 || stderr != "" {
+				t.Fatalf("Exit code %d, stderr: %s", code, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected %q, got: %q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+func TestToTextColors(t *testing.T) {
+	input := `{"level":"warn","ts":1704164645.5,"logger":"db","caller":"app/main.go:3","msg":"slow","n":1,"user":"bob"}` + "\n"
+	tests := []struct {
+		color    string
+		expected string
+	}{
+		{"always", "\x1b[36mts\x1b[0m=\x1b[90m\"2024-01-02T03:04:05.500Z\"\x1b[0m \x1b[33mWARN\x1b[0m \x1b[1mdb\x1b[0m \x1b[90mapp/main.go:3\x1b[0m slow " +
+			"\x1b[36mn\x1b[0m=\x1b[94m1\x1b[0m \x1b[36muser\x1b[0m=\x1b[32mbob\x1b[0m\n"},
+		// The output isn't a terminal.
+		{"auto", `ts="2024-01-02T03:04:05.500Z" WARN db app/main.go:3 slow n=1 user=bob` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.color, func(t *testing.T) {
+			stdout, stderr, code := runCommand(t, input, "totext", "-color", tt.color)
+			if code != 0 || stderr != "" {
+				t.Fatalf("Exit code %d, stderr: %s", code, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected %q, got: %q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range [][]string{nil, {"-logfmt"}, {"-keyed", "-multiline-stack"}} {
+		encoders := []string{"-level-encoder", "lowercase", "-time-encoder", "epoch"}
+		text, stderr, code := runCommand(t, jsonLog, append(append([]string{"totext"}, format...), encoders...)...)
+		if code != 0 || stderr != "" {
+			t.Fatalf("totext %v: exit code %d, stderr: %s", format, code, stderr)
+		}
+		back, stderr, code := runCommand(t, text, append(append([]string{"tojson"}, format...), encoders...)...)
+		if code != 0 || stderr != "" {
+			t.Fatalf("tojson %v: exit code %d, stderr: %s", format, code, stderr)
+		}
+		expected := jsonLog
+		if len(format) > 0 && format[0] == "-logfmt" {
+			// Strict logfmt flattens arrays and objects to strings.
+			expected = strings.Replace(expected, `["a","b c",1]`, `"[a,\"b c\",1]"`, 1)
+			expected = strings.Replace(expected, `{"k":"v","inner":{"x":1}}`, `"{k=v inner={x=1}}"`, 1)
+		}
+		if back != expected {
+			t.Errorf("Round trip through %v:\n got: %s\nwant: %s", format, back, expected)
+		}
+	}
+}
+
+func TestRoundTripMessageEndingWithBrace(t *testing.T) {
+	input := `{"level":"error","msg":"boom {","k":"v"}` + "\n"
+	text, stderr, code := runCommand(t, input, "totext", "-level-encoder", "lowercase")
+	if code != 0 || stderr != "" {
+		t.Fatalf("totext: exit code %d, stderr: %s", code, stderr)
+	}
+	back, stderr, code := runCommand(t, text, "tojson", "-level-encoder", "lowercase")
+	if code != 0 || stderr != "" {
+		t.Fatalf("tojson: exit code %d, stderr: %s", code, stderr)
+	}
+	if back != input {
+		t.Errorf("Round trip:\n got: %s\nwant: %s", back, input)
+	}
+}
+
+func TestUndecodableLines(t *testing.T) {
+	stdout, stderr, code := runCommand(t, "panic: oops\n\n{\"level\":\"info\",\"msg\":\"ok\"}\n", "totext")
+	if code != 0 {
+		t.Fatalf("Exit code %d, stderr: %s", code, stderr)
+	}
+	if stdout != "panic: oops\nINFO ok\n" {
+		t.Errorf("Unexpected output: %q", stdout)
+	}
+	if !strings.Contains(stderr, "line 1:") {
+		t.Errorf("Expected the bad line to be reported, got: %q", stderr)
+	}
+
+	stdout, stderr, _ = runCommand(t, "panic: oops\nINFO ok\n", "tojson", "-level-encoder", "lowercase")
+	if stdout != "panic: oops\n{\"level\":\"info\",\"msg\":\"ok\"}\n" {
+		t.Errorf("Unexpected output: %q", stdout)
+	}
+	if !strings.Contains(stderr, "entry 1:") {
+		t.Errorf("Expected the bad entry to be reported, got: %q", stderr)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"bogus"},
+		{"totext", "-bogus"},
+		{"totext", "-time-encoder", "bogus"},
+		{"tojson", "-level-encoder", "bogus"},
+		{"totext", "-color", "bogus"},
+		{"tojson", "-color", "always"},
+	} {
+		if _, _, code := runCommand(t, "", args...); code != 2 {
+			t.Errorf("run(%q) exit code = %d, expected 2", args, code)
+		}
+	}
+	if _, _, code := runCommand(t, "", "totext", "/does/not/exist"); code != 1 {
+		t.Errorf("Expected exit code 1 for a missing file, got %d", code)
+	}
+}
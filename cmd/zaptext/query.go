@@ -0,0 +1,437 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaiiak/zaptext"
+	"go.uber.org/zap/zapcore"
+)
+
+// queryOptions holds the flags of the query command.
+type queryOptions struct {
+	level string
+	since string
+	until string
+	where string
+	json  bool
+
+	minLevel   zapcore.Level
+	hasLevel   bool
+	start, end time.Time
+	filter     expr
+}
+
+func (q *queryOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&q.level, "level", "", "minimum level of the entries")
+	fs.StringVar(&q.since, "since", "", "earliest time of the entries, RFC 3339 or a duration before now")
+	fs.StringVar(&q.until, "until", "", "latest time of the entries, RFC 3339 or a duration before now")
+	fs.StringVar(&q.where, "where", "", `field expression, e.g. 'status>=500 && path~"/api"'`)
+	fs.BoolVar(&q.json, "json", false, "write the matching entries as zap JSON")
+}
+
+// init validates the flags once they are parsed. Durations are relative to
+// now.
+func (q *queryOptions) init(now time.Time) error {
+	var err error
+	if q.level != "" {
+		if err := q.minLevel.UnmarshalText([]byte(q.level)); err != nil {
+			return fmt.Errorf("unrecognized level %q", q.level)
+		}
+		q.hasLevel = true
+	}
+	if q.start, err = parseTimeFlag(q.since, now); err != nil {
+		return err
+	}
+	if q.end, err = parseTimeFlag(q.until, now); err != nil {
+		return err
+	}
+	if q.where != "" {
+		if q.filter, err = parseExpr(q.where); err != nil {
+			return fmt.Errorf("invalid expression: %v", err)
+		}
+	}
+	return nil
+}
+
+func parseTimeFlag(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected RFC 3339 or a duration", s)
+	}
+	return t, nil
+}
+
+// match reports whether rec passes the level, time and field filters.
+func (q *queryOptions) match(rec *zaptext.Record, cfg *zapcore.EncoderConfig) bool {
+	if q.hasLevel && rec.Level < q.minLevel {
+		return false
+	}
+	if !q.start.IsZero() && (rec.Time.IsZero() || rec.Time.Before(q.start)) {
+		return false
+	}
+	if !q.end.IsZero() && (rec.Time.IsZero() || rec.Time.After(q.end)) {
+		return false
+	}
+	return q.filter == nil || q.filter.eval(&record{rec, cfg})
+}
+
+// query writes the text entries that match the filters, unchanged or as JSON.
+// Entries that can't be parsed never match.
+func query(opts *options, in io.Reader, out, stderr io.Writer) error {
+	w := newJSONWriter(opts.cfg)
+	s := zaptext.NewScanner(in, zaptext.NewParser(opts.cfg, opts.textOptions()...))
+	for s.Scan() {
+		rec, err := s.Record()
+		if err != nil || !opts.query.match(&rec, &opts.cfg) {
+			continue
+		}
+		if opts.query.json {
+			err = w.write(out, rec)
+		} else {
+			_, err = io.WriteString(out, s.Text()+"\n")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// record resolves the keys of an expression against a Record: the keys of
+// the EncoderConfig name the header, others the fields. Dots descend into
+// objects, so user.id matches both a user.id field and the id field of a
+// user object.
+type record struct {
+	*zaptext.Record
+	cfg *zapcore.EncoderConfig
+}
+
+func (r *record) lookup(key string) (zaptext.Value, bool) {
+	str := func(s string) (zaptext.Value, bool) {
+		return zaptext.Value{Kind: zaptext.StringKind, Text: s}, true
+	}
+	switch key {
+	case "":
+	case r.cfg.LevelKey:
+		return str(r.Level.String())
+	case r.cfg.TimeKey:
+		if !r.Time.IsZero() {
+			return str(r.Time.Format(time.RFC3339Nano))
+		}
+		return zaptext.Value{}, false
+	case r.cfg.NameKey:
+		return str(r.LoggerName)
+	case r.cfg.CallerKey:
+		return str(r.Caller)
+	case r.cfg.FunctionKey:
+		return str(r.Function)
+	case r.cfg.MessageKey:
+		return str(r.Message)
+	case r.cfg.StacktraceKey:
+		if r.Stack != "" {
+			return str(r.Stack)
+		}
+	}
+	return lookupField(r.Fields, key)
+}
+
+func lookupField(fields []zaptext.Field, key string) (zaptext.Value, bool) {
+	for _, f := range fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	for _, f := range fields {
+		if f.Value.Kind == zaptext.ObjectKind && strings.HasPrefix(key, f.Key+".") {
+			if v, ok := lookupField(f.Value.Fields, key[len(f.Key)+1:]); ok {
+				return v, true
+			}
+		}
+	}
+	return zaptext.Value{}, false
+}
+
+// expr is a node of a field expression.
+type expr interface {
+	eval(r *record) bool
+}
+
+type andExpr struct{ left, right expr }
+
+func (e andExpr) eval(r *record) bool { return e.left.eval(r) && e.right.eval(r) }
+
+type orExpr struct{ left, right expr }
+
+func (e orExpr) eval(r *record) bool { return e.left.eval(r) || e.right.eval(r) }
+
+type notExpr struct{ expr expr }
+
+func (e notExpr) eval(r *record) bool { return !e.expr.eval(r) }
+
+// comparison compares a field with a literal. Without an operator it tests
+// that the field is present. Missing fields never compare.
+type comparison struct {
+	key   string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (c *comparison) eval(r *record) bool {
+	v, ok := r.lookup(c.key)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "":
+		return true
+	case "~":
+		return c.re.MatchString(v.Text)
+	case "!~":
+		return !c.re.MatchString(v.Text)
+	}
+
+	var cmp int
+	if c.key == r.cfg.LevelKey {
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(c.value)); err != nil {
+			return false
+		}
+		cmp = compare(float64(r.Level), float64(level))
+	} else if x, y, ok := numbers(v, c.value); ok {
+		cmp = compare(x, y)
+	} else {
+		cmp = strings.Compare(v.Text, c.value)
+	}
+	switch c.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+func compare(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// numbers parses both sides of a comparison as numbers. Numbers compare
+// numerically, so that status>=500 doesn't match status=60.
+func numbers(v zaptext.Value, literal string) (x, y float64, ok bool) {
+	x, err := strconv.ParseFloat(v.Text, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	y, err = strconv.ParseFloat(literal, 64)
+	return x, y, err == nil
+}
+
+// parseExpr parses a field expression:
+//
+//	expr       = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | "(" expr ")" | comparison
+//	comparison = key [ op value ]
+//	op         = "==" | "=" | "!=" | "<" | "<=" | ">" | ">=" | "~" | "!~"
+//
+// Keys and values are bare words or double quoted strings; "~" and "!~"
+// match regular expressions.
+func parseExpr(s string) (expr, error) {
+	tokens, err := tokenizeExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.next(); ok {
+		return nil, fmt.Errorf("unexpected %q", tok.text)
+	}
+	return e, nil
+}
+
+// exprToken is an operator, a parenthesis or a word, with the quotes of quoted
+// words removed.
+type exprToken struct {
+	text string
+	word bool
+}
+
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "!~", "=", "<", ">", "~", "!", "(", ")"}
+
+func tokenizeExpr(s string) ([]exprToken, error) {
+	var tokens []exprToken
+	for pos := 0; pos < len(s); {
+		if s[pos] == ' ' || s[pos] == '\t' {
+			pos++
+			continue
+		}
+		if op := operatorAt(s[pos:]); op != "" {
+			tokens = append(tokens, exprToken{text: op})
+			pos += len(op)
+			continue
+		}
+		start := pos
+		if s[pos] == '"' {
+			for pos++; pos < len(s) && s[pos] != '"'; pos++ {
+				if s[pos] == '\\' {
+					pos++
+				}
+			}
+			if pos >= len(s) {
+				return nil, fmt.Errorf("unterminated string %s", s[start:])
+			}
+			pos++
+			word, err := strconv.Unquote(s[start:pos])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", s[start:pos])
+			}
+			tokens = append(tokens, exprToken{text: word, word: true})
+			continue
+		}
+		for pos < len(s) && s[pos] != ' ' && s[pos] != '\t' && operatorAt(s[pos:]) == "" {
+			pos++
+		}
+		tokens = append(tokens, exprToken{text: s[start:pos], word: true})
+	}
+	return tokens, nil
+}
+
+func operatorAt(s string) string {
+	for _, op := range exprOperators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// peek returns the next token without consuming it.
+func (p *exprParser) peek() exprToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return exprToken{}
+}
+
+func (p *exprParser) next() (exprToken, bool) {
+	if p.pos < len(p.tokens) {
+		p.pos++
+		return p.tokens[p.pos-1], true
+	}
+	return exprToken{}, false
+}
+
+// isOperator reports whether the next token is the operator op.
+func (p *exprParser) isOperator(op string) bool {
+	tok := p.peek()
+	return !tok.word && tok.text == op
+}
+
+func (p *exprParser) or() (expr, error) {
+	left, err := p.and()
+	for err == nil && p.isOperator("||") {
+		p.next()
+		var right expr
+		if right, err = p.and(); err == nil {
+			left = orExpr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) and() (expr, error) {
+	left, err := p.unary()
+	for err == nil && p.isOperator("&&") {
+		p.next()
+		var right expr
+		if right, err = p.unary(); err == nil {
+			left = andExpr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) unary() (expr, error) {
+	tok, ok := p.next()
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok.word:
+		return p.comparison(tok.text)
+	case tok.text == "!":
+		e, err := p.unary()
+		return notExpr{e}, err
+	case tok.text == "(":
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOperator(")") {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.next()
+		return e, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", tok.text)
+}
+
+func (p *exprParser) comparison(key string) (expr, error) {
+	c := &comparison{key: key}
+	op := p.peek()
+	switch {
+	case op.word:
+		return nil, fmt.Errorf("unexpected %q after %s", op.text, key)
+	case op.text == "==", op.text == "=", op.text == "!=", op.text == "<", op.text == "<=", op.text == ">", op.text == ">=", op.text == "~", op.text == "!~":
+		p.next()
+		c.op = op.text
+		if c.op == "=" {
+			c.op = "=="
+		}
+		value, ok := p.next()
+		if !ok || !value.word {
+			return nil, fmt.Errorf("missing value after %s%s", key, op.text)
+		}
+		c.value = value.text
+	}
+	if c.op == "~" || c.op == "!~" {
+		re, err := regexp.Compile(c.value)
+		if err != nil {
+			return nil, err
+		}
+		c.re = re
+	}
+	return c, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const textLog = `ts="2024-01-02T03:00:00.000Z" INFO api/server.go:10 request served status=200 path=/api/users latency=12 user={id=7 name=bob}
+ts="2024-01-02T03:10:00.000Z" WARN api/server.go:10 request served status=404 path=/static/logo.png latency=3
+ts="2024-01-02T03:20:00.000Z" ERROR api/server.go:10 request failed status=500 path=/api/orders latency=1500 error="db down"
+not a zaptext line
+ts="2024-01-02T03:30:00.000Z" ERROR api/server.go:20 request failed status=60 path="/api/a b" http.method=POST
+`
+
+func TestQuery(t *testing.T) {
+	lines := strings.Split(textLog, "\n")
+	tests := []struct {
+		name     string
+		args     []string
+		expected []int // the matching lines of textLog
+	}{
+		{"No filters", nil, []int{0, 1, 2, 4}},
+		{"Level", []string{"-level", "warn"}, []int{1, 2, 4}},
+		{"Since", []string{"-since", "2024-01-02T03:10:00Z"}, []int{1, 2, 4}},
+		{"Time range", []string{"-since", "2024-01-02T03:05:00Z", "-until", "2024-01-02T03:20:00Z"}, []int{1, 2}},
+		{"Numeric comparison", []string{"-where", "status>=500"}, []int{2}},
+		{"Regular expression", []string{"-where", `path~"^/api"`}, []int{0, 2, 4}},
+		{"Conjunction", []string{"-where", `status>=500 && path~"/api"`}, []int{2}},
+		{"Disjunction and negation", []string{"-where", `!(status==200 || latency>100)`}, []int{1, 4}},
+		{"Presence", []string{"-where", "error"}, []int{2}},
+		{"Quoted value", []string{"-where", `path="/api/a b"`}, []int{4}},
+		{"Object path", []string{"-where", "user.name=bob"}, []int{0}},
+		{"Namespace prefix", []string{"-where", "http.method=POST"}, []int{4}},
+		{"Message", []string{"-where", `msg~failed && caller!="api/server.go:20"`}, []int{2}},
+		{"Level expression", []string{"-where", "level<error"}, []int{0, 1}},
+		{"Missing fields never compare", []string{"-where", "latency!=12"}, []int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, code := runCommand(t, textLog, append([]string{"query"}, tt.args...)...)
+			if code != 0 || stderr != "" {
+				t.Fatalf("Exit code %d, stderr: %s", code, stderr)
+			}
+			var expected strings.Builder
+			for _, i := range tt.expected {
+				expected.WriteString(lines[i] + "\n")
+			}
+			if stdout != expected.String() {
+				t.Errorf("Expected:\n%s\ngot:\n%s", expected.String(), stdout)
+			}
+		})
+	}
+}
+
+func TestQueryJSON(t *testing.T) {
+	stdout, stderr, code := runCommand(t, textLog, "query", "-json", "-level-encoder", "lowercase", "-where", "status=404")
+	if code != 0 || stderr != "" {
+		t.Fatalf("Exit code %d, stderr: %s", code, stderr)
+	}
+	expected := `{"level":"warn","ts":"2024-01-02T03:10:00.000Z","caller":"api/server.go:10","msg":"request served","status":404,"path":"/static/logo.png","latency":3}` + "\n"
+	if stdout != expected {
+		t.Errorf("Expected %q, got: %q", expected, stdout)
+	}
+}
+
+func TestQueryUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"-level", "bogus"},
+		{"-since", "yesterday"},
+		{"-where", "status>="},
+		{"-where", "(status==1"},
+		{"-where", `path~"["`},
+		{"-where", `path="unterminated`},
+		{"-where", "a b"},
+	} {
+		if _, _, code := runCommand(t, "", append([]string{"query"}, args...)...); code != 2 {
+			t.Errorf("query %q exit code = %d, expected 2", args, code)
+		}
+	}
+	if _, _, code := runCommand(t, "", "totext", "-where", "a"); code != 2 {
+		t.Errorf("Expected query flags to be rejected by totext")
+	}
+}
@@ -0,0 +1,195 @@
+package zaptext
+
+import (
+	"io"
+	"os"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// ColorMode selects whether TextEncoder colors its output with ANSI escape
+// codes.
+type ColorMode int8
+
+const (
+	// ColorNever never writes color codes. This is the default.
+	ColorNever ColorMode = iota
+	// ColorAuto colors the output only when the writer set with
+	// TextEncoder.SetColorOutput is a terminal and the NO_COLOR environment
+	// variable is unset or empty. Without a writer nothing is colored, since
+	// the encoder can't tell where its output goes.
+	ColorAuto
+	// ColorAlways writes color codes wherever the output goes.
+	ColorAlways
+)
+
+// Color is an ANSI SGR parameter string, e.g. "31" for red or "1;34" for bold
+// blue. An empty Color leaves the text uncolored.
+type Color string
+
+// Palette holds the colors of the parts of an entry. Levels above ErrorLevel
+// share its color. Error colors the string values of error fields passed to
+// the log call.
+type Palette struct {
+	Time       Color `json:"time" yaml:"time"`
+	DebugLevel Color `json:"debugLevel" yaml:"debugLevel"`
+	InfoLevel  Color `json:"infoLevel" yaml:"infoLevel"`
+	WarnLevel  Color `json:"warnLevel" yaml:"warnLevel"`
+	ErrorLevel Color `json:"errorLevel" yaml:"errorLevel"`
+	Name       Color `json:"name" yaml:"name"`
+	Caller     Color `json:"caller" yaml:"caller"`
+	Message    Color `json:"message" yaml:"message"`
+	Key        Color `json:"key" yaml:"key"`
+	String     Color `json:"string" yaml:"string"`
+	Number     Color `json:"number" yaml:"number"`
+	Bool       Color `json:"bool" yaml:"bool"`
+	Error      Color `json:"error" yaml:"error"`
+}
+
+// DefaultPalette returns the palette used unless another one is set: gray
+// times and callers, levels from magenta to red, cyan keys, green strings,
+// blue numbers, magenta booleans and bold red errors. Messages are left
+// uncolored.
+func DefaultPalette() Palette {
+	return Palette{
+		Time:       "90",
+		DebugLevel: "35",
+		InfoLevel:  "34",
+		WarnLevel:  "33",
+		ErrorLevel: "31",
+		Name:       "1",
+		Caller:     "90",
+		Key:        "36",
+		String:     "32",
+		Number:     "94",
+		Bool:       "95",
+		Error:      "1;31",
+	}
+}
+
+// colorRole identifies the part of an entry a color span is written for.
+type colorRole uint8
+
+const (
+	colorTime colorRole = iota
+	colorDebugLevel
+	colorInfoLevel
+	colorWarnLevel
+	colorErrorLevel
+	colorName
+	colorCaller
+	colorMessage
+	colorKey
+	colorString
+	colorNumber
+	colorBool
+	colorError
+)
+
+func levelColorRole(level zapcore.Level) colorRole {
+	switch {
+	case level <= zapcore.DebugLevel:
+		return colorDebugLevel
+	case level == zapcore.InfoLevel:
+		return colorInfoLevel
+	case level == zapcore.WarnLevel:
+		return colorWarnLevel
+	}
+	return colorErrorLevel
+}
+
+func (p *Palette) color(role colorRole) Color {
+	switch role {
+	case colorTime:
+		return p.Time
+	case colorDebugLevel:
+		return p.DebugLevel
+	case colorInfoLevel:
+		return p.InfoLevel
+	case colorWarnLevel:
+		return p.WarnLevel
+	case colorErrorLevel:
+		return p.ErrorLevel
+	case colorName:
+		return p.Name
+	case colorCaller:
+		return p.Caller
+	case colorMessage:
+		return p.Message
+	case colorKey:
+		return p.Key
+	case colorString:
+		return p.String
+	case colorNumber:
+		return p.Number
+	case colorBool:
+		return p.Bool
+	}
+	return p.Error
+}
+
+// updateColors resolves the ColorMode once the mode or the output changes, so
+// that encoding never has to look at the terminal or the environment.
+func (opts *textOptions) updateColors() {
+	switch opts.colorMode {
+	case ColorAlways:
+		opts.colors = true
+	case ColorAuto:
+		opts.colors = os.Getenv("NO_COLOR") == "" && isTerminal(opts.colorOutput)
+	default:
+		opts.colors = false
+	}
+	if opts.colors && opts.palette == nil {
+		palette := DefaultPalette()
+		opts.palette = &palette
+	}
+}
+
+// isTerminal reports whether w is a character device, such as *os.File for a
+// terminal. Writers that wrap a file, e.g. zapcore.Lock, aren't recognized.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(interface{ Stat() (os.FileInfo, error) })
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// beginColor starts a span in the color of role and reports whether it did.
+// Spans don't nest: the values written inside a colored header token, e.g.
+// the string appended by EncodeTime, keep the color of the token.
+func (enc *TextEncoder) beginColor(role colorRole) bool {
+	if !enc.opts.colors || enc.colorSpan != colorSpanNone {
+		return false
+	}
+	c := enc.opts.palette.color(role)
+	if c == "" {
+		enc.colorSpan = colorSpanPlain
+		return true
+	}
+	enc.buf.AppendString("\x1b[")
+	enc.buf.AppendString(string(c))
+	enc.buf.AppendByte('m')
+	enc.colorSpan = colorSpanColored
+	return true
+}
+
+// endColor ends the span started by beginColor, if it started one.
+func (enc *TextEncoder) endColor(began bool) {
+	if !began {
+		return
+	}
+	if enc.colorSpan == colorSpanColored {
+		enc.buf.AppendString("\x1b[0m")
+	}
+	enc.colorSpan = colorSpanNone
+}
+
+// The states of TextEncoder.colorSpan. A plain span writes no codes but still
+// keeps nested values uncolored.
+const (
+	colorSpanNone uint8 = iota
+	colorSpanPlain
+	colorSpanColored
+)
@@ -0,0 +1,195 @@
+package zaptext_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/kaiiak/zaptext"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// colored wraps s in the ANSI codes of color.
+func colored(color Color, s string) string {
+	return "\x1b[" + string(color) + "m" + s + "\x1b[0m"
+}
+
+func colorTestConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:      "ts",
+		LevelKey:     "level",
+		NameKey:      "logger",
+		CallerKey:    "caller",
+		MessageKey:   "msg",
+		EncodeTime:   zapcore.RFC3339TimeEncoder,
+		EncodeLevel:  zapcore.CapitalLevelEncoder,
+		EncodeCaller: zapcore.ShortCallerEncoder,
+	}
+}
+
+var colorTestEntry = zapcore.Entry{
+	Level:      zapcore.WarnLevel,
+	Time:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	LoggerName: "db",
+	Caller:     zapcore.EntryCaller{Defined: true, File: "/src/app/main.go", Line: 3},
+	Message:    "slow query",
+}
+
+var colorTestFields = []zapcore.Field{
+	zap.String("user", "bob"),
+	zap.Int("rows", 42),
+	zap.Bool("cached", false),
+	zap.Error(errors.New("timeout")),
+	zap.Strings("tags", []string{"a", "b"}),
+}
+
+func TestTextEncoderColors(t *testing.T) {
+	p := DefaultPalette()
+	key := func(k string) string { return colored(p.Key, k) + "=" }
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected string
+	}{
+		{
+			name:     "Disabled by default",
+			expected: `ts="2024-01-02T03:04:05Z" WARN db app/main.go:3 slow query user=bob rows=42 cached=false error=timeout tags=[a,b]`,
+		},
+		{
+			name: "Always",
+			opts: []Option{WithColorMode(ColorAlways)},
+			expected: key("ts") + colored(p.Time, `"2024-01-02T03:04:05Z"`) + " " + colored(p.WarnLevel, "WARN") + " " +
+				colored(p.Name, "db") + " " + colored(p.Caller, "app/main.go:3") + " slow query " +
+				key("user") + colored(p.String, "bob") + " " + key("rows") + colored(p.Number, "42") + " " +
+				key("cached") + colored(p.Bool, "false") + " " + key("error") + colored(p.Error, "timeout") + " " +
+				key("tags") + "[" + colored(p.String, "a") + "," + colored(p.String, "b") + "]",
+		},
+		{
+			name: "Keyed header and custom palette",
+			opts: []Option{
+				WithColorMode(ColorAlways),
+				WithKeyedLevel(true),
+				WithKeyedMessage(true),
+				WithPalette(Palette{WarnLevel: "1;33", Message: "1"}),
+			},
+			expected: `ts="2024-01-02T03:04:05Z" level=` + colored("1;33", "WARN") + ` db app/main.go:3 msg=` + colored("1", `"slow query"`) +
+				` user=bob rows=42 cached=false error=timeout tags=[a,b]`,
+		},
+		{
+			name: "Strict logfmt flattens before coloring",
+			opts: []Option{WithColorMode(ColorAlways), WithStrictLogfmt(true), WithPalette(Palette{String: "32"})},
+			expected: `ts=2024-01-02T03:04:05Z level=WARN logger=db caller=app/main.go:3 msg="slow query" user=` + colored("32", "bob") +
+				` rows=42 cached=false error=timeout tags=` + colored("32", "[a,b]"),
+		},
+		{
+			name:     "Auto without an output",
+			opts:     []Option{WithColorMode(ColorAuto)},
+			expected: `ts="2024-01-02T03:04:05Z" WARN db app/main.go:3 slow query user=bob rows=42 cached=false error=timeout tags=[a,b]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewTextEncoderWithOptions(colorTestConfig(), tt.opts...)
+			buf, err := enc.EncodeEntry(colorTestEntry, colorTestFields)
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			defer buf.Free()
+
+			expected := tt.expected + "\n"
+			if got := buf.String(); got != expected {
+				t.Errorf("Expected %q, got: %q", expected, got)
+			}
+		})
+	}
+}
+
+func TestTextEncoderColorAuto(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "log")
+	if err != nil {
+		t.Fatalf("CreateTemp failed: %v", err)
+	}
+	defer file.Close()
+	// The null device is a character device like a terminal.
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Skipf("Can't open %s: %v", os.DevNull, err)
+	}
+	defer devNull.Close()
+	if fi, err := devNull.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		t.Skipf("%s isn't a character device", os.DevNull)
+	}
+
+	tests := []struct {
+		name    string
+		out     *os.File
+		noColor string
+		colored bool
+	}{
+		{"Regular file", file, "", false},
+		{"Character device", devNull, "", true},
+		{"NO_COLOR", devNull, "1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			enc := NewTextEncoderWithOptions(colorTestConfig(), WithColorMode(ColorAuto), WithColorOutput(tt.out))
+			buf, err := enc.EncodeEntry(colorTestEntry, colorTestFields)
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			defer buf.Free()
+
+			if got := strings.Contains(buf.String(), "\x1b["); got != tt.colored {
+				t.Errorf("Expected colored=%v, got: %q", tt.colored, buf.String())
+			}
+		})
+	}
+}
+
+func TestParserIgnoresColors(t *testing.T) {
+	cfg := colorTestConfig()
+	enc := NewTextEncoderWithOptions(cfg, WithColorMode(ColorAlways))
+	buf, err := enc.EncodeEntry(colorTestEntry, colorTestFields)
+	if err != nil {
+		t.Fatalf("EncodeEntry failed: %v", err)
+	}
+	defer buf.Free()
+
+	rec, err := NewParser(cfg).Parse(buf.String())
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if rec.Level != zapcore.WarnLevel || rec.LoggerName != "db" || rec.Caller != "app/main.go:3" || rec.Message != "slow query" {
+		t.Errorf("Unexpected header: %+v", rec)
+	}
+	if len(rec.Fields) != 5 || rec.Fields[0].Key != "user" || rec.Fields[0].Value.Text != "bob" || rec.Fields[3].Value.Text != "timeout" {
+		t.Errorf("Unexpected fields: %+v", rec.Fields)
+	}
+}
+
+func TestConfigColors(t *testing.T) {
+	var config Config
+	raw := `{"colors": "always", "palette": {"key": "36"}}`
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		t.Fatalf("Unmarshal Config failed: %v", err)
+	}
+
+	enc := NewTextEncoderWithOptions(zapcore.EncoderConfig{}, config)
+	buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{zap.Int("n", 1)})
+	if err != nil {
+		t.Fatalf("EncodeEntry failed: %v", err)
+	}
+	defer buf.Free()
+
+	expected := colored("36", "n") + "=1\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("Expected %q, got: %q", expected, got)
+	}
+}
@@ -151,7 +151,7 @@ func TestTextEncoderDirectAccess(t *testing.T) {
 	t.Run("Test encoder methods directly", func(t *testing.T) {
 		encoder := NewTextEncoder(cfg)
 
-		// Test OpenNamespace directly - it's a no-op but should be called
+		// Test OpenNamespace directly
 		encoder.OpenNamespace("test_namespace")
 
 		// Create a test entry to encode
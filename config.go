@@ -0,0 +1,211 @@
+package zaptext
+
+import (
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// TextEncoding is the zap.Config encoding name of a TextEncoder with the
+	// default settings.
+	TextEncoding = "text"
+	// LogfmtEncoding is the zap.Config encoding name of a TextEncoder in
+	// strict logfmt mode, see TextEncoder.SetStrictLogfmt.
+	LogfmtEncoding = "logfmt"
+)
+
+func init() {
+	// Registration only fails if the names are already taken, in which case
+	// the existing encoders win.
+	_ = RegisterEncoder(TextEncoding)
+	_ = RegisterEncoder(LogfmtEncoding, WithStrictLogfmt(true))
+}
+
+// Config holds the settings of a TextEncoder that have no counterpart in
+// zapcore.EncoderConfig. Like zapcore.EncoderConfig, it can be unmarshaled
+// from JSON or YAML, so these settings can live next to a zap.Config in
+// configuration files. Each field mirrors the TextEncoder setter of the same
+// name; QuoteChar holds a single character, an empty string selecting the
+// default. Quote predicates can only be set in code, with WithQuotePredicate.
+//
+// ColorOutput names the output that ColorAuto checks for a terminal, "stdout"
+// or "stderr"; it should match the OutputPaths of the zap.Config. Left empty,
+// ColorAuto never colors. A nil Palette selects DefaultPalette.
+type Config struct {
+	NestedNamespaces       bool             `json:"nestedNamespaces" yaml:"nestedNamespaces"`
+	KeyedLevel             bool             `json:"keyedLevel" yaml:"keyedLevel"`
+	KeyedName              bool             `json:"keyedName" yaml:"keyedName"`
+	KeyedCaller            bool             `json:"keyedCaller" yaml:"keyedCaller"`
+	KeyedMessage           bool             `json:"keyedMessage" yaml:"keyedMessage"`
+	SanitizePolicy         SanitizePolicy   `json:"sanitizePolicy" yaml:"sanitizePolicy"`
+	StacktraceFormat       StacktraceFormat `json:"stacktraceFormat" yaml:"stacktraceFormat"`
+	StacktraceMaxFrames    int              `json:"stacktraceMaxFrames" yaml:"stacktraceMaxFrames"`
+	StacktraceSkipInternal bool             `json:"stacktraceSkipInternal" yaml:"stacktraceSkipInternal"`
+	StrictLogfmt           bool             `json:"strictLogfmt" yaml:"strictLogfmt"`
+	QuotePolicy            QuotePolicy      `json:"quotePolicy" yaml:"quotePolicy"`
+	QuoteChar              string           `json:"quoteChar" yaml:"quoteChar"`
+	Colors                 ColorMode        `json:"colors" yaml:"colors"`
+	ColorOutput            string           `json:"colorOutput" yaml:"colorOutput"`
+	Palette                *Palette         `json:"palette" yaml:"palette"`
+	Columns                Columns          `json:"columns" yaml:"columns"`
+}
+
+// apply copies the settings in c to enc, which makes Config an Option.
+func (c Config) apply(enc *TextEncoder) {
+	enc.SetNestedNamespaces(c.NestedNamespaces)
+	enc.SetKeyedLevel(c.KeyedLevel)
+	enc.SetKeyedName(c.KeyedName)
+	enc.SetKeyedCaller(c.KeyedCaller)
+	enc.SetKeyedMessage(c.KeyedMessage)
+	enc.SetSanitizePolicy(c.SanitizePolicy)
+	enc.SetStacktraceFormat(c.StacktraceFormat)
+	enc.SetStacktraceMaxFrames(c.StacktraceMaxFrames)
+	enc.SetStacktraceSkipInternal(c.StacktraceSkipInternal)
+	enc.SetStrictLogfmt(c.StrictLogfmt)
+	enc.SetQuotePolicy(c.QuotePolicy)
+	var quote byte
+	if len(c.QuoteChar) == 1 {
+		quote = c.QuoteChar[0]
+	}
+	enc.SetQuoteChar(quote)
+	if c.Palette != nil {
+		enc.SetPalette(*c.Palette)
+	} else {
+		enc.SetPalette(DefaultPalette())
+	}
+	switch c.ColorOutput {
+	case "stdout":
+		enc.SetColorOutput(os.Stdout)
+	case "stderr":
+		enc.SetColorOutput(os.Stderr)
+	default:
+		enc.SetColorOutput(nil)
+	}
+	enc.SetColorMode(c.Colors)
+	enc.SetColumns(c.Columns)
+}
+
+// RegisterEncoder registers a TextEncoder configured with opts under name, so
+// that it can be selected with the Encoding field of a zap.Config. A Config
+// unmarshaled from a configuration file can be passed as an option. The
+// "text" and "logfmt" encodings are registered by this package.
+func RegisterEncoder(name string, opts ...Option) error {
+	return zap.RegisterEncoder(name, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return NewTextEncoderWithOptions(cfg, opts...), nil
+	})
+}
+
+// MarshalText marshals the SanitizePolicy to text.
+func (p SanitizePolicy) MarshalText() ([]byte, error) {
+	switch p {
+	case SanitizeEscape:
+		return []byte("escape"), nil
+	case SanitizeQuote:
+		return []byte("quote"), nil
+	case SanitizeReplace:
+		return []byte("replace"), nil
+	}
+	return nil, fmt.Errorf("unknown sanitize policy: %d", p)
+}
+
+// UnmarshalText unmarshals text to a SanitizePolicy: "escape", "quote" or
+// "replace". An empty string selects the default, SanitizeEscape.
+func (p *SanitizePolicy) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "escape", "":
+		*p = SanitizeEscape
+	case "quote":
+		*p = SanitizeQuote
+	case "replace":
+		*p = SanitizeReplace
+	default:
+		return fmt.Errorf("unrecognized sanitize policy: %q", text)
+	}
+	return nil
+}
+
+// MarshalText marshals the StacktraceFormat to text.
+func (f StacktraceFormat) MarshalText() ([]byte, error) {
+	switch f {
+	case StacktraceField:
+		return []byte("field"), nil
+	case StacktraceMultiline:
+		return []byte("multiline"), nil
+	}
+	return nil, fmt.Errorf("unknown stacktrace format: %d", f)
+}
+
+// UnmarshalText unmarshals text to a StacktraceFormat: "field" or
+// "multiline". An empty string selects the default, StacktraceField.
+func (f *StacktraceFormat) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "field", "":
+		*f = StacktraceField
+	case "multiline":
+		*f = StacktraceMultiline
+	default:
+		return fmt.Errorf("unrecognized stacktrace format: %q", text)
+	}
+	return nil
+}
+
+// MarshalText marshals the QuotePolicy to text.
+func (p QuotePolicy) MarshalText() ([]byte, error) {
+	switch p {
+	case QuoteWhenNeeded:
+		return []byte("needed"), nil
+	case QuoteAlways:
+		return []byte("always"), nil
+	case QuoteNever:
+		return []byte("never"), nil
+	}
+	return nil, fmt.Errorf("unknown quote policy: %d", p)
+}
+
+// UnmarshalText unmarshals text to a QuotePolicy: "needed", "always" or
+// "never". An empty string selects the default, QuoteWhenNeeded.
+func (p *QuotePolicy) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "needed", "":
+		*p = QuoteWhenNeeded
+	case "always":
+		*p = QuoteAlways
+	case "never":
+		*p = QuoteNever
+	default:
+		return fmt.Errorf("unrecognized quote policy: %q", text)
+	}
+	return nil
+}
+
+// MarshalText marshals the ColorMode to text.
+func (m ColorMode) MarshalText() ([]byte, error) {
+	switch m {
+	case ColorNever:
+		return []byte("never"), nil
+	case ColorAuto:
+		return []byte("auto"), nil
+	case ColorAlways:
+		return []byte("always"), nil
+	}
+	return nil, fmt.Errorf("unknown color mode: %d", m)
+}
+
+// UnmarshalText unmarshals text to a ColorMode: "never", "auto" or "always".
+// An empty string selects the default, ColorNever.
+func (m *ColorMode) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "never", "":
+		*m = ColorNever
+	case "auto":
+		*m = ColorAuto
+	case "always":
+		*m = ColorAlways
+	default:
+		return fmt.Errorf("unrecognized color mode: %q", text)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package zaptext_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/kaiiak/zaptext"
+	"go.uber.org/zap"
+)
+
+func buildFromJSON(t *testing.T, encoding string) (*zap.Logger, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "out.log")
+	raw := `{
+		"level": "info",
+		"encoding": "` + encoding + `",
+		"outputPaths": [` + strings.TrimSpace(mustMarshal(t, path)) + `],
+		"encoderConfig": {
+			"messageKey": "msg",
+			"levelKey": "level",
+			"nameKey": "logger",
+			"levelEncoder": "capital"
+		}
+	}`
+
+	var cfg zap.Config
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		t.Fatalf("Unmarshal zap.Config failed: %v", err)
+	}
+	logger, err := cfg.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	return logger, path
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	return string(b)
+}
+
+func readLog(t *testing.T, logger *zap.Logger, path string) string {
+	t.Helper()
+
+	_ = logger.Sync()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	return string(b)
+}
+
+func TestRegisteredEncodings(t *testing.T) {
+	tests := []struct {
+		encoding string
+		expected string
+	}{
+		{TextEncoding, "INFO db user logged in user=bob\n"},
+		{LogfmtEncoding, `level=INFO logger=db msg="user logged in" user=bob` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			logger, path := buildFromJSON(t, tt.encoding)
+			logger.Named("db").Info("user logged in", zap.String("user", "bob"))
+
+			if got := readLog(t, logger, path); got != tt.expected {
+				t.Errorf("Expected %q, got: %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	var config Config
+	raw := `{"keyedMessage": true, "sanitizePolicy": "replace", "nestedNamespaces": true, "stacktraceFormat": "multiline"}`
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		t.Fatalf("Unmarshal Config failed: %v", err)
+	}
+	if config.SanitizePolicy != SanitizeReplace || config.StacktraceFormat != StacktraceMultiline {
+		t.Fatalf("Unexpected config: %+v", config)
+	}
+
+	if err := RegisterEncoder("text-test", config); err != nil {
+		t.Fatalf("RegisterEncoder failed: %v", err)
+	}
+	if err := RegisterEncoder("text-test", config); err == nil {
+		t.Errorf("Expected an error when registering the same name twice")
+	}
+
+	logger, path := buildFromJSON(t, "text-test")
+	logger.Info("hello", zap.Namespace("ns"), zap.String("bad key", "v"))
+
+	expected := `INFO msg=hello ns={bad_key=v}` + "\n"
+	if got := readLog(t, logger, path); got != expected {
+		t.Errorf("Expected %q, got: %q", expected, got)
+	}
+}
+
+func TestConfigTextMarshaling(t *testing.T) {
+	config := Config{SanitizePolicy: SanitizeQuote, StacktraceFormat: StacktraceMultiline, QuotePolicy: QuoteNever, Colors: ColorAuto}
+	out := mustMarshal(t, config)
+	if !strings.Contains(out, `"sanitizePolicy":"quote"`) || !strings.Contains(out, `"stacktraceFormat":"multiline"`) || !strings.Contains(out, `"quotePolicy":"never"`) || !strings.Contains(out, `"colors":"auto"`) {
+		t.Errorf("Unexpected JSON: %s", out)
+	}
+
+	var roundTrip Config
+	if err := json.Unmarshal([]byte(out), &roundTrip); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if roundTrip != config {
+		t.Errorf("Expected %+v, got %+v", config, roundTrip)
+	}
+
+	var policy SanitizePolicy
+	if err := policy.UnmarshalText([]byte("bogus")); err == nil {
+		t.Errorf("Expected an error for an unknown sanitize policy")
+	}
+	var format StacktraceFormat
+	if err := format.UnmarshalText([]byte("bogus")); err == nil {
+		t.Errorf("Expected an error for an unknown stacktrace format")
+	}
+	var quote QuotePolicy
+	if err := quote.UnmarshalText([]byte("bogus")); err == nil {
+		t.Errorf("Expected an error for an unknown quote policy")
+	}
+	var colors ColorMode
+	if err := colors.UnmarshalText([]byte("bogus")); err == nil {
+		t.Errorf("Expected an error for an unknown color mode")
+	}
+	if _, err := SanitizePolicy(42).MarshalText(); err == nil {
+		t.Errorf("Expected an error for an invalid sanitize policy")
+	}
+	if _, err := StacktraceFormat(42).MarshalText(); err == nil {
+		t.Errorf("Expected an error for an invalid stacktrace format")
+	}
+	if _, err := QuotePolicy(42).MarshalText(); err == nil {
+		t.Errorf("Expected an error for an invalid quote policy")
+	}
+	if _, err := ColorMode(42).MarshalText(); err == nil {
+		t.Errorf("Expected an error for an invalid color mode")
+	}
+}
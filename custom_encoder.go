@@ -1,7 +1,12 @@
 package zaptext
 
 import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"go.uber.org/zap/zapcore"
 )
@@ -12,3 +17,98 @@ func CustomTimeEncoderFactory(layout string) zapcore.TimeEncoder {
 		pae.AppendString(t.Format(layout))
 	}
 }
+
+// ModuleCallerEncoderFactory return a zapcore.CallerEncoder that formats the
+// caller as a path relative to the root of module, e.g.
+// services/api/handler.go:42 for a caller in github.com/org/mono/services/api.
+// The package is taken from the caller's function name, so the result doesn't
+// depend on where the binary was built. Callers outside module, or without a
+// function name, fall back to zapcore.ShortCallerEncoder.
+func ModuleCallerEncoderFactory(module string) zapcore.CallerEncoder {
+	prefix := strings.TrimSuffix(module, "/") + "/"
+	return func(caller zapcore.EntryCaller, pae zapcore.PrimitiveArrayEncoder) {
+		pkg := functionPackage(caller.Function)
+		if !strings.HasPrefix(pkg, prefix) {
+			zapcore.ShortCallerEncoder(caller, pae)
+			return
+		}
+		pae.AppendString(strings.TrimPrefix(pkg, prefix) + "/" + path.Base(caller.File) + ":" + strconv.Itoa(caller.Line))
+	}
+}
+
+// FunctionCallerEncoder formats the caller as its package-qualified function
+// name and line, e.g. api.(*Handler).Serve:42. Callers without a function name
+// fall back to zapcore.ShortCallerEncoder.
+func FunctionCallerEncoder(caller zapcore.EntryCaller, pae zapcore.PrimitiveArrayEncoder) {
+	if caller.Function == "" {
+		zapcore.ShortCallerEncoder(caller, pae)
+		return
+	}
+	fn := caller.Function
+	if idx := strings.LastIndexByte(fn, '/'); idx >= 0 {
+		fn = fn[idx+1:]
+	}
+	pae.AppendString(fn + ":" + strconv.Itoa(caller.Line))
+}
+
+// AbbreviatedNameEncoder shortens every segment of a dotted logger name but
+// the last one to its first character, e.g. server.http.handler becomes
+// s.h.handler.
+func AbbreviatedNameEncoder(loggerName string, pae zapcore.PrimitiveArrayEncoder) {
+	pae.AppendString(abbreviateName(loggerName))
+}
+
+// PaddedNameEncoderFactory return a zapcore.NameEncoder that pads the output
+// of encoder with trailing spaces to width characters, so that bare logger
+// names line up in columns. Longer names are left intact. A nil encoder
+// defaults to zapcore.FullNameEncoder.
+func PaddedNameEncoderFactory(width int, encoder zapcore.NameEncoder) zapcore.NameEncoder {
+	if encoder == nil {
+		encoder = zapcore.FullNameEncoder
+	}
+	return func(loggerName string, pae zapcore.PrimitiveArrayEncoder) {
+		arr := getSliceEncoder()
+		defer putSliceEncoder(arr)
+
+		encoder(loggerName, arr)
+		var sb strings.Builder
+		for i, elem := range arr.elems {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			fmt.Fprint(&sb, elem)
+		}
+		name := sb.String()
+		if n := width - utf8.RuneCountInString(name); n > 0 {
+			name += strings.Repeat(" ", n)
+		}
+		pae.AppendString(name)
+	}
+}
+
+func abbreviateName(name string) string {
+	last := strings.LastIndexByte(name, '.')
+	if last < 0 {
+		return name
+	}
+	var sb strings.Builder
+	sb.Grow(len(name))
+	for _, segment := range strings.Split(name[:last], ".") {
+		if r, size := utf8.DecodeRuneInString(segment); size > 0 {
+			sb.WriteRune(r)
+		}
+		sb.WriteByte('.')
+	}
+	sb.WriteString(name[last+1:])
+	return sb.String()
+}
+
+// functionPackage returns the import path of the package that declares fn, a
+// fully qualified function name as reported by runtime.Frame.
+func functionPackage(fn string) string {
+	slash := strings.LastIndexByte(fn, '/')
+	if dot := strings.IndexByte(fn[slash+1:], '.'); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return fn
+}
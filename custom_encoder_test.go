@@ -5,6 +5,7 @@ import (
 	"time"
 
 	. "github.com/kaiiak/zaptext"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestCustomTimeEncoderFactory(t *testing.T) {
@@ -62,6 +63,146 @@ func TestCustomTimeEncoderFactory(t *testing.T) {
 	})
 }
 
+func TestModuleCallerEncoderFactory(t *testing.T) {
+	encoder := ModuleCallerEncoderFactory("github.com/org/mono")
+
+	tests := []struct {
+		name     string
+		caller   zapcore.EntryCaller
+		expected string
+	}{
+		{
+			name: "Caller inside module",
+			caller: zapcore.EntryCaller{
+				Defined:  true,
+				File:     "/build/src/mono/services/api/handler.go",
+				Line:     42,
+				Function: "github.com/org/mono/services/api.(*Handler).Serve",
+			},
+			expected: "services/api/handler.go:42",
+		},
+		{
+			name: "Caller inside module with trailing slash",
+			caller: zapcore.EntryCaller{
+				Defined:  true,
+				File:     "/build/src/mono/pkg/db/db.go",
+				Line:     7,
+				Function: "github.com/org/mono/pkg/db.Open.func1",
+			},
+			expected: "pkg/db/db.go:7",
+		},
+		{
+			name: "Caller outside module",
+			caller: zapcore.EntryCaller{
+				Defined:  true,
+				File:     "/go/pkg/mod/github.com/other/lib/lib.go",
+				Line:     3,
+				Function: "github.com/other/lib.Do",
+			},
+			expected: "lib/lib.go:3",
+		},
+		{
+			name:     "Caller without function",
+			caller:   zapcore.EntryCaller{Defined: true, File: "/a/b/c.go", Line: 1},
+			expected: "b/c.go:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockEncoder := &mockPrimitiveArrayEncoder{}
+			encoder(tt.caller, mockEncoder)
+
+			if mockEncoder.value != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, mockEncoder.value)
+			}
+		})
+	}
+}
+
+func TestFunctionCallerEncoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   zapcore.EntryCaller
+		expected string
+	}{
+		{
+			name:     "Method",
+			caller:   zapcore.EntryCaller{Defined: true, File: "/x/handler.go", Line: 42, Function: "github.com/org/mono/api.(*Handler).Serve"},
+			expected: "api.(*Handler).Serve:42",
+		},
+		{
+			name:     "Main package",
+			caller:   zapcore.EntryCaller{Defined: true, File: "/x/main.go", Line: 9, Function: "main.main"},
+			expected: "main.main:9",
+		},
+		{
+			name:     "No function",
+			caller:   zapcore.EntryCaller{Defined: true, File: "/x/y/main.go", Line: 9},
+			expected: "y/main.go:9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockEncoder := &mockPrimitiveArrayEncoder{}
+			FunctionCallerEncoder(tt.caller, mockEncoder)
+
+			if mockEncoder.value != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, mockEncoder.value)
+			}
+		})
+	}
+}
+
+func TestAbbreviatedNameEncoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"server.http.handler", "s.h.handler"},
+		{"db", "db"},
+		{"a.b", "a.b"},
+		{"ünicode.näme.leaf", "ü.n.leaf"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		mockEncoder := &mockPrimitiveArrayEncoder{}
+		AbbreviatedNameEncoder(tt.name, mockEncoder)
+
+		if mockEncoder.value != tt.expected {
+			t.Errorf("AbbreviatedNameEncoder(%q) = '%s', want '%s'", tt.name, mockEncoder.value, tt.expected)
+		}
+	}
+}
+
+func TestPaddedNameEncoderFactory(t *testing.T) {
+	tests := []struct {
+		name     string
+		width    int
+		encoder  zapcore.NameEncoder
+		input    string
+		expected string
+	}{
+		{"Pads short names", 6, nil, "db", "db    "},
+		{"Keeps long names", 3, zapcore.FullNameEncoder, "database", "database"},
+		{"Pads abbreviated names", 12, AbbreviatedNameEncoder, "server.http.handler", "s.h.handler "},
+		{"Counts runes", 4, nil, "日志", "日志  "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockEncoder := &mockPrimitiveArrayEncoder{}
+			PaddedNameEncoderFactory(tt.width, tt.encoder)(tt.input, mockEncoder)
+
+			if mockEncoder.value != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, mockEncoder.value)
+			}
+		})
+	}
+}
+
 // Mock implementation of zapcore.PrimitiveArrayEncoder for testing
 type mockPrimitiveArrayEncoder struct {
 	called bool
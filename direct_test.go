@@ -27,12 +27,27 @@ func TestTextEncoderDirectMethods(t *testing.T) {
 
 	t.Run("Test OpenNamespace method directly", func(t *testing.T) {
 		encoder := NewTextEncoder(cfg).(*TextEncoder)
-		encoder.OpenNamespace("test_namespace") // This is a no-op, just testing it doesn't crash
+		encoder.OpenNamespace("test_namespace")
 		encoder.AddString("key", "value")
 
 		output := encoder.buf.String()
-		if output != "key=value" {
-			t.Errorf("Expected 'key=value', got: %s", output)
+		if output != "test_namespace.key=value" {
+			t.Errorf("Expected 'test_namespace.key=value', got: %s", output)
+		}
+	})
+
+	t.Run("Test nested OpenNamespace method directly", func(t *testing.T) {
+		encoder := NewTextEncoder(cfg).(*TextEncoder)
+		encoder.SetNestedNamespaces(true)
+		encoder.OpenNamespace("outer")
+		encoder.AddString("key", "value")
+		encoder.OpenNamespace("inner")
+		encoder.AddInt("num", 1)
+		encoder.closeOpenNamespaces()
+
+		output := encoder.buf.String()
+		if output != "outer={key=value inner={num=1}}" {
+			t.Errorf("Expected 'outer={key=value inner={num=1}}', got: %s", output)
 		}
 	})
 
@@ -72,19 +87,24 @@ func TestTextEncoderDirectMethods(t *testing.T) {
 		}
 
 		output := encoder.buf.String()
-		if output != "key=value num=42" {
-			t.Errorf("Expected 'key=value num=42', got: '%s'", output)
+		if output != "{key=value num=42}" {
+			t.Errorf("Expected '{key=value num=42}', got: '%s'", output)
 		}
 	})
 
 	t.Run("Test AppendReflected method directly", func(t *testing.T) {
 		encoder := NewTextEncoder(cfg).(*TextEncoder)
 
-		// AppendReflected is currently a no-op, just test it doesn't crash
+		// Strings are appended like AppendString would
 		err := encoder.AppendReflected("test value")
 		if err != nil {
 			t.Errorf("AppendReflected failed: %v", err)
 		}
+
+		output := encoder.buf.String()
+		if output != `"test value"` {
+			t.Errorf("Expected '\"test value\"', got: '%s'", output)
+		}
 	})
 
 	t.Run("Test AppendUint and AppendUintptr directly", func(t *testing.T) {
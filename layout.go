@@ -0,0 +1,162 @@
+package zaptext
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// Columns configures the aligned layout of EncodeEntry: the level, logger
+// name, caller and message are padded with trailing spaces to the given
+// widths, so that the tokens after them start at the same column on every
+// line, and shortened with an ellipsis when they are longer. Widths count
+// terminal cells: East Asian wide characters, such as CJK ideographs and most
+// emoji, take two cells and combining marks none. A zero width leaves the
+// column as is.
+//
+// A keyed token is aligned by its value, since its key is the same on every
+// line. Bare tokens missing from an entry, such as the logger name of the
+// root logger, are replaced with blanks; keyed ones are omitted as usual.
+type Columns struct {
+	Level   int `json:"level" yaml:"level"`
+	Name    int `json:"name" yaml:"name"`
+	Caller  int `json:"caller" yaml:"caller"`
+	Message int `json:"message" yaml:"message"`
+}
+
+const ellipsis = "…"
+
+// addColumn writes text with write, in the color of role, and aligns the
+// rendered token to cells terminal cells. Tokens that are too wide are written again
+// from a shortened text until they fit, since quoting and escaping make the
+// rendered width differ from the width of text.
+func (enc *TextEncoder) addColumn(cells int, role colorRole, text string, write func(*TextEncoder, string)) {
+	began := enc.beginColor(role)
+	start := enc.buf.Len()
+	write(enc, text)
+	orig, keep := text, stringWidth(text)
+	for cells > 0 {
+		w := displayWidth(enc.buf.Bytes()[start:])
+		if w <= cells {
+			enc.pad += cells - w
+			break
+		}
+		if keep == 0 {
+			// Even the ellipsis alone doesn't fit.
+			break
+		}
+		keep -= w - cells
+		if text == orig {
+			keep -= stringWidth(ellipsis)
+		}
+		if keep < 0 {
+			keep = 0
+		}
+		text = truncateWidth(orig, keep) + ellipsis
+		enc.truncate(start)
+		write(enc, text)
+	}
+	enc.endColor(began)
+}
+
+// skipColumn leaves a blank column of cells terminal cells for a missing bare
+// token, including the separator that would precede it.
+func (enc *TextEncoder) skipColumn(cells int) {
+	if cells <= 0 {
+		return
+	}
+	if enc.buf.Len() > 0 || enc.pad > 0 {
+		enc.pad++
+	}
+	enc.pad += cells
+}
+
+// truncate shortens the buffer to its first n bytes.
+func (enc *TextEncoder) truncate(n int) {
+	b := enc.buf.Bytes()[:n]
+	enc.buf.Reset()
+	_, _ = enc.buf.Write(b)
+}
+
+// appendRaw writes a bare token as is.
+func appendRaw(enc *TextEncoder, s string) {
+	enc.buf.AppendString(s)
+}
+
+// appendMessage writes a bare message, sanitized.
+func appendMessage(enc *TextEncoder, s string) {
+	enc.addSanitized(s, isUnsafeMessageRune)
+}
+
+// runeWidth returns the number of terminal cells taken by r.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// ansiSequenceLen returns the length of the ANSI escape sequence at the start
+// of s, or 0.
+func ansiSequenceLen(s string) int {
+	if len(s) < 2 || s[0] != 0x1b || s[1] != '[' {
+		return 0
+	}
+	i := 2
+	for i < len(s) && (s[i] < 0x40 || s[i] > 0x7e) {
+		i++
+	}
+	if i < len(s) {
+		i++
+	}
+	return i
+}
+
+// stringWidth returns the number of terminal cells taken by s, not counting
+// ANSI escape sequences.
+func stringWidth(s string) int {
+	w := 0
+	for i := 0; i < len(s); {
+		if n := ansiSequenceLen(s[i:]); n > 0 {
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		w += runeWidth(r)
+		i += size
+	}
+	return w
+}
+
+// displayWidth is stringWidth for rendered bytes.
+func displayWidth(b []byte) int {
+	return stringWidth(string(b))
+}
+
+// truncateWidth returns the longest prefix of s that fits in w cells. ANSI
+// escape sequences are all kept, so that colors are still reset.
+func truncateWidth(s string, w int) string {
+	out := make([]byte, 0, len(s))
+	full := false
+	for i := 0; i < len(s); {
+		if n := ansiSequenceLen(s[i:]); n > 0 {
+			out = append(out, s[i:i+n]...)
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if rw := runeWidth(r); !full && rw <= w {
+			out = append(out, s[i:i+size]...)
+			w -= rw
+		} else {
+			full = true
+		}
+		i += size
+	}
+	return string(out)
+}
@@ -0,0 +1,134 @@
+package zaptext_test
+
+import (
+	"testing"
+
+	. "github.com/kaiiak/zaptext"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestColumns(t *testing.T) {
+	cfg := zapcore.EncoderConfig{
+		LevelKey:     "level",
+		NameKey:      "logger",
+		CallerKey:    "caller",
+		MessageKey:   "msg",
+		EncodeLevel:  zapcore.CapitalLevelEncoder,
+		EncodeCaller: zapcore.ShortCallerEncoder,
+	}
+	caller := zapcore.EntryCaller{Defined: true, File: "/src/app/main.go", Line: 3}
+	columns := Columns{Level: 5, Name: 6, Caller: 14, Message: 12}
+	fields := []zapcore.Field{zap.Int("n", 1)}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		entry    zapcore.Entry
+		fields   []zapcore.Field
+		expected string
+	}{
+		{
+			name:     "Padding",
+			opts:     []Option{WithColumns(columns)},
+			entry:    zapcore.Entry{Level: zapcore.InfoLevel, LoggerName: "db", Caller: caller, Message: "started"},
+			fields:   fields,
+			expected: "INFO  db     app/main.go:3  started      n=1",
+		},
+		{
+			name:     "Truncation",
+			opts:     []Option{WithColumns(columns)},
+			entry:    zapcore.Entry{Level: zapcore.ErrorLevel, LoggerName: "database", Caller: caller, Message: "unexpectedly long message"},
+			fields:   fields,
+			expected: "ERROR datab… app/main.go:3  unexpectedl… n=1",
+		},
+		{
+			name:     "Missing tokens",
+			opts:     []Option{WithColumns(columns)},
+			entry:    zapcore.Entry{Level: zapcore.WarnLevel},
+			fields:   fields,
+			expected: "WARN                                     n=1",
+		},
+		{
+			name:     "Wide characters",
+			opts:     []Option{WithColumns(columns)},
+			entry:    zapcore.Entry{Level: zapcore.InfoLevel, LoggerName: "数据库", Caller: caller, Message: "🚀 用户登录"},
+			fields:   fields,
+			expected: "INFO  数据库 app/main.go:3  🚀 用户登录  n=1",
+		},
+		{
+			name:     "Wide characters truncated",
+			opts:     []Option{WithColumns(columns)},
+			entry:    zapcore.Entry{Level: zapcore.InfoLevel, LoggerName: "数据库服务", Caller: caller, Message: "用户登录成功完成"},
+			fields:   fields,
+			expected: "INFO  数据…  app/main.go:3  用户登录成…  n=1",
+		},
+		{
+			name:     "No trailing spaces",
+			opts:     []Option{WithColumns(columns)},
+			entry:    zapcore.Entry{Level: zapcore.InfoLevel, LoggerName: "db", Caller: caller, Message: "started"},
+			expected: "INFO  db     app/main.go:3  started",
+		},
+		{
+			name:     "Keyed tokens align their values",
+			opts:     []Option{WithColumns(columns), WithKeyedLevel(true), WithKeyedMessage(true)},
+			entry:    zapcore.Entry{Level: zapcore.InfoLevel, LoggerName: "db", Caller: caller, Message: "hello world"},
+			fields:   fields,
+			expected: `level=INFO  db     app/main.go:3  msg="hello wor…" n=1`,
+		},
+		{
+			name:     "Colors",
+			opts:     []Option{WithColumns(Columns{Level: 5}), WithColorMode(ColorAlways), WithPalette(Palette{InfoLevel: "34"})},
+			entry:    zapcore.Entry{Level: zapcore.InfoLevel, Message: "started"},
+			expected: "\x1b[34mINFO\x1b[0m  started",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewTextEncoderWithOptions(cfg, tt.opts...)
+			buf, err := enc.EncodeEntry(tt.entry, tt.fields)
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			defer buf.Free()
+
+			expected := tt.expected + "\n"
+			if got := buf.String(); got != expected {
+				t.Errorf("Expected %q, got: %q", expected, got)
+			}
+		})
+	}
+}
+
+func TestColumnsParse(t *testing.T) {
+	cfg := zapcore.EncoderConfig{
+		LevelKey:     "level",
+		NameKey:      "logger",
+		CallerKey:    "caller",
+		MessageKey:   "msg",
+		EncodeLevel:  zapcore.CapitalLevelEncoder,
+		EncodeCaller: zapcore.ShortCallerEncoder,
+	}
+	opts := []Option{WithColumns(Columns{Level: 5, Name: 6, Caller: 14, Message: 20})}
+	enc := NewTextEncoderWithOptions(cfg, opts...)
+	entry := zapcore.Entry{
+		Level:      zapcore.InfoLevel,
+		LoggerName: "db",
+		Caller:     zapcore.EntryCaller{Defined: true, File: "/src/app/main.go", Line: 3},
+		Message:    "user  logged in",
+	}
+	buf, err := enc.EncodeEntry(entry, []zapcore.Field{zap.String("user", "bob")})
+	if err != nil {
+		t.Fatalf("EncodeEntry failed: %v", err)
+	}
+	defer buf.Free()
+
+	rec, err := NewParser(cfg, opts...).Parse(buf.String())
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if rec.LoggerName != "db" || rec.Caller != "app/main.go:3" || rec.Message != entry.Message || len(rec.Fields) != 1 {
+		t.Errorf("Unexpected record: %+v", rec)
+	}
+}
@@ -0,0 +1,50 @@
+package zaptext
+
+import "unicode/utf8"
+
+// isInvalidLogfmtKeyRune reports whether r can't appear in a logfmt key.
+func isInvalidLogfmtKeyRune(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == 0x7f || r == utf8.RuneError
+}
+
+// needsLogfmtQuoting reports whether s must be quoted to be read back as a
+// single logfmt value. Unlike needsQuoting, an empty string is written as
+// nothing at all (key=), which logfmt parsers read as an empty value.
+func needsLogfmtQuoting(s string) bool {
+	for _, r := range s {
+		if isInvalidLogfmtKeyRune(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// addLogfmtKey writes s, a key or namespace prefix, replacing the characters
+// that logfmt doesn't allow in keys with underscores. Strict logfmt mode uses
+// it instead of the SanitizePolicy, since escaped or quoted keys aren't valid
+// logfmt either.
+func (enc *TextEncoder) addLogfmtKey(s string) {
+	for _, r := range s {
+		if isInvalidLogfmtKeyRune(r) {
+			enc.buf.AppendByte('_')
+		} else {
+			enc.buf.AppendString(string(r))
+		}
+	}
+}
+
+// addFlattened writes the array or object produced by write as a single
+// string value. Strict logfmt only knows flat values, so composite values are
+// rendered by a scratch encoder in the regular text format, with the default
+// quoting and no colors, and then quoted and escaped as a whole when needed.
+func (enc *TextEncoder) addFlattened(write func(*TextEncoder) error) error {
+	scratch := enc.clone()
+	scratch.opts.strictLogfmt = false
+	scratch.opts.quotePolicy, scratch.opts.quotePredicate, scratch.opts.quote = QuoteWhenNeeded, nil, 0
+	scratch.opts.colors = false
+	err := write(scratch)
+	enc.appendStringValue(scratch.buf.String())
+	scratch.buf.Free()
+	putTextEncoder(scratch)
+	return err
+}
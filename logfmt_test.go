@@ -0,0 +1,102 @@
+package zaptext_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/kaiiak/zaptext"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestStrictLogfmt(t *testing.T) {
+	cfg := zapcore.EncoderConfig{
+		TimeKey:       "ts",
+		LevelKey:      "level",
+		NameKey:       "logger",
+		CallerKey:     "caller",
+		FunctionKey:   "func",
+		MessageKey:    "msg",
+		StacktraceKey: "stacktrace",
+		EncodeTime:    zapcore.ISO8601TimeEncoder,
+		EncodeLevel:   zapcore.LowercaseLevelEncoder,
+		EncodeCaller:  zapcore.ShortCallerEncoder,
+	}
+	entry := zapcore.Entry{
+		Time:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Level:      zap.InfoLevel,
+		LoggerName: "db",
+		Message:    "user logged in",
+		Caller:     zapcore.EntryCaller{Defined: true, File: "/src/app/main.go", Line: 3, Function: "main.main"},
+	}
+
+	tests := []struct {
+		name     string
+		fields   []zapcore.Field
+		stack    string
+		expected string
+	}{
+		{
+			name:     "Header",
+			expected: `ts=2024-01-02T03:04:05.000Z level=info logger=db caller=app/main.go:3 func=main.main msg="user logged in"` + "\n",
+		},
+		{
+			name: "Values",
+			fields: []zapcore.Field{
+				zap.String("plain", "value"),
+				zap.String("empty", ""),
+				zap.String("equals", "a=b"),
+				zap.String("quote", `say "hi"`),
+				zap.String("newline", "a\nb"),
+				zap.String("unicode", "héllo"),
+				zap.Int("int", 42),
+				zap.Bool("bool", true),
+			},
+			expected: `ts=2024-01-02T03:04:05.000Z level=info logger=db caller=app/main.go:3 func=main.main msg="user logged in" plain=value empty= equals="a=b" quote="say \"hi\"" newline="a\nb" unicode=héllo int=42 bool=true` + "\n",
+		},
+		{
+			name: "Keys",
+			fields: []zapcore.Field{
+				zap.String("user id", "1"),
+				zap.String("a=b", "2"),
+				zap.String(`"q"`, "3"),
+				zap.String("", "4"),
+			},
+			expected: `ts=2024-01-02T03:04:05.000Z level=info logger=db caller=app/main.go:3 func=main.main msg="user logged in" user_id=1 a_b=2 _q_=3 _=4` + "\n",
+		},
+		{
+			name: "Composite values",
+			fields: []zapcore.Field{
+				zap.Strings("tags", []string{"a", "b"}),
+				zap.Object("obj", testObject{name: "a b", count: 1}),
+				zap.Any("map", map[string]int{"x": 1}),
+			},
+			expected: `ts=2024-01-02T03:04:05.000Z level=info logger=db caller=app/main.go:3 func=main.main msg="user logged in" tags=[a,b] obj="{name=\"a b\" count=1}" map="{\"x\":1}"` + "\n",
+		},
+		{
+			name:     "Namespaces and stacks",
+			fields:   []zapcore.Field{zap.Namespace("req"), zap.String("id", "7")},
+			stack:    "main.main\n\t/src/app/main.go:10",
+			expected: `ts=2024-01-02T03:04:05.000Z level=info logger=db caller=app/main.go:3 func=main.main msg="user logged in" req.id=7 stacktrace="main.main\n\t/src/app/main.go:10"` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewTextEncoderWithOptions(cfg,
+				WithStrictLogfmt(true),
+				WithNestedNamespaces(true),
+				WithStacktraceFormat(StacktraceMultiline),
+			)
+			ent := entry
+			ent.Stack = tt.stack
+			buf, err := enc.EncodeEntry(ent, tt.fields)
+			if err != nil {
+				t.Fatalf("EncodeEntry() error = %v", err)
+			}
+			defer buf.Free()
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("EncodeEntry() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
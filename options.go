@@ -0,0 +1,167 @@
+package zaptext
+
+import (
+	"io"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// An Option configures a TextEncoder. Config also satisfies Option, applying
+// all of its settings at once.
+type Option interface {
+	apply(*TextEncoder)
+}
+
+// optionFunc wraps a func so it satisfies the Option interface.
+type optionFunc func(*TextEncoder)
+
+func (f optionFunc) apply(enc *TextEncoder) {
+	f(enc)
+}
+
+// NewTextEncoderWithOptions creates a TextEncoder like NewTextEncoder and
+// applies opts to it in order. The options are carried over to encoders
+// obtained through Clone, e.g. by logger.With.
+func NewTextEncoderWithOptions(cfg zapcore.EncoderConfig, opts ...Option) zapcore.Encoder {
+	enc := NewTextEncoder(cfg).(*TextEncoder)
+	for _, opt := range opts {
+		opt.apply(enc)
+	}
+	return enc
+}
+
+// WithNestedNamespaces renders namespaces as nested blocks instead of key
+// prefixes, see TextEncoder.SetNestedNamespaces.
+func WithNestedNamespaces(nested bool) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetNestedNamespaces(nested)
+	})
+}
+
+// WithKeyedLevel renders the level as a key=value pair, see
+// TextEncoder.SetKeyedLevel.
+func WithKeyedLevel(keyed bool) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetKeyedLevel(keyed)
+	})
+}
+
+// WithKeyedName renders the logger name as a key=value pair, see
+// TextEncoder.SetKeyedName.
+func WithKeyedName(keyed bool) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetKeyedName(keyed)
+	})
+}
+
+// WithKeyedCaller renders the caller and function as key=value pairs, see
+// TextEncoder.SetKeyedCaller.
+func WithKeyedCaller(keyed bool) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetKeyedCaller(keyed)
+	})
+}
+
+// WithKeyedMessage renders the message as a key=value pair, see
+// TextEncoder.SetKeyedMessage.
+func WithKeyedMessage(keyed bool) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetKeyedMessage(keyed)
+	})
+}
+
+// WithSanitizePolicy sets how unsafe characters in messages and keys are
+// neutralized, see TextEncoder.SetSanitizePolicy.
+func WithSanitizePolicy(policy SanitizePolicy) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetSanitizePolicy(policy)
+	})
+}
+
+// WithStacktraceFormat sets how stack traces are rendered, see
+// TextEncoder.SetStacktraceFormat.
+func WithStacktraceFormat(format StacktraceFormat) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetStacktraceFormat(format)
+	})
+}
+
+// WithStacktraceMaxFrames limits the number of stack trace frames, see
+// TextEncoder.SetStacktraceMaxFrames.
+func WithStacktraceMaxFrames(frames int) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetStacktraceMaxFrames(frames)
+	})
+}
+
+// WithStacktraceSkipInternal drops zap and runtime frames from stack traces,
+// see TextEncoder.SetStacktraceSkipInternal.
+func WithStacktraceSkipInternal(skip bool) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetStacktraceSkipInternal(skip)
+	})
+}
+
+// WithStrictLogfmt enables strict logfmt compliance, see
+// TextEncoder.SetStrictLogfmt.
+func WithStrictLogfmt(strict bool) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetStrictLogfmt(strict)
+	})
+}
+
+// WithQuotePolicy configures when string values are quoted, see
+// TextEncoder.SetQuotePolicy.
+func WithQuotePolicy(policy QuotePolicy) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetQuotePolicy(policy)
+	})
+}
+
+// WithQuotePredicate decides with quote whether string values are quoted,
+// see TextEncoder.SetQuotePredicate.
+func WithQuotePredicate(quote func(value string) bool) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetQuotePredicate(quote)
+	})
+}
+
+// WithQuoteChar configures the character that delimits quoted values, see
+// TextEncoder.SetQuoteChar.
+func WithQuoteChar(quote byte) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetQuoteChar(quote)
+	})
+}
+
+// WithColorMode configures whether the output is colored, see
+// TextEncoder.SetColorMode.
+func WithColorMode(mode ColorMode) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetColorMode(mode)
+	})
+}
+
+// WithColorOutput sets the writer that ColorAuto checks for a terminal, see
+// TextEncoder.SetColorOutput.
+func WithColorOutput(out io.Writer) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetColorOutput(out)
+	})
+}
+
+// WithPalette configures the colors of the output, see
+// TextEncoder.SetPalette.
+func WithPalette(palette Palette) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetPalette(palette)
+	})
+}
+
+// WithColumns aligns the level, logger name, caller and message in columns,
+// see TextEncoder.SetColumns.
+func WithColumns(columns Columns) Option {
+	return optionFunc(func(enc *TextEncoder) {
+		enc.SetColumns(columns)
+	})
+}
@@ -0,0 +1,112 @@
+package zaptext_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/kaiiak/zaptext"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewTextEncoderWithOptions(t *testing.T) {
+	cfg := zapcore.EncoderConfig{
+		LevelKey:      "level",
+		NameKey:       "logger",
+		CallerKey:     "caller",
+		MessageKey:    "msg",
+		StacktraceKey: "stacktrace",
+		EncodeLevel:   zapcore.LowercaseLevelEncoder,
+		EncodeCaller:  zapcore.ShortCallerEncoder,
+	}
+	entry := zapcore.Entry{
+		Level:      zap.ErrorLevel,
+		LoggerName: "db",
+		Message:    "a=b",
+		Caller:     zapcore.EntryCaller{Defined: true, File: "/src/app/main.go", Line: 3},
+		Stack:      testStack,
+	}
+	fields := []zapcore.Field{zap.Namespace("ns"), zap.String("key", "value")}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected string
+	}{
+		{
+			name:     "No options",
+			expected: `error db app/main.go:3 a\=b ns.key=value stacktrace="` + strings.ReplaceAll(strings.ReplaceAll(testStack, "\n", `\n`), "\t", `\t`) + "\"\n",
+		},
+		{
+			name: "Keyed header",
+			opts: []Option{
+				WithKeyedLevel(true),
+				WithKeyedName(true),
+				WithKeyedCaller(true),
+				WithKeyedMessage(true),
+				WithStacktraceMaxFrames(1),
+			},
+			expected: `level=error logger=db caller="app/main.go:3" msg="a=b" ns.key=value stacktrace="go.uber.org/zap.(*Logger).Error\n\t/go/pkg/mod/go.uber.org/zap/logger.go:220\n... 4 more frames"` + "\n",
+		},
+		{
+			name: "Namespaces, sanitizing and multiline stacks",
+			opts: []Option{
+				WithNestedNamespaces(true),
+				WithSanitizePolicy(SanitizeQuote),
+				WithStacktraceFormat(StacktraceMultiline),
+				WithStacktraceSkipInternal(true),
+				WithStacktraceMaxFrames(1),
+			},
+			expected: "error db app/main.go:3 \"a=b\" ns={key=value}\n\tmain.handle\n\t\t/src/app/main.go:30\n\t... 2 more frames\n",
+		},
+		{
+			name: "Config as an option",
+			opts: []Option{
+				Config{KeyedMessage: true, StacktraceFormat: StacktraceMultiline, StacktraceMaxFrames: 1},
+			},
+			expected: "error db app/main.go:3 msg=\"a=b\" ns.key=value\n\tgo.uber.org/zap.(*Logger).Error\n\t\t/go/pkg/mod/go.uber.org/zap/logger.go:220\n\t... 4 more frames\n",
+		},
+		{
+			name: "Later options win",
+			opts: []Option{
+				Config{KeyedMessage: true, StacktraceMaxFrames: 1},
+				WithKeyedMessage(false),
+				WithStacktraceMaxFrames(0),
+				WithStacktraceSkipInternal(true),
+			},
+			expected: `error db app/main.go:3 a\=b ns.key=value stacktrace="main.handle\n\t/src/app/main.go:30\nmain.serve\n\t/src/app/main.go:20\nmain.main\n\t/src/app/main.go:10"` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewTextEncoderWithOptions(cfg, tt.opts...)
+
+			buf, err := enc.EncodeEntry(entry, fields)
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("Expected:\n%q\ngot:\n%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTextEncoderOptionsSurviveClone(t *testing.T) {
+	cfg := zapcore.EncoderConfig{LevelKey: "level", MessageKey: "msg", EncodeLevel: zapcore.LowercaseLevelEncoder}
+	enc := NewTextEncoderWithOptions(cfg, WithKeyedLevel(true), WithKeyedMessage(true), WithNestedNamespaces(true))
+
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(enc, zapcore.AddSync(&buf), zap.InfoLevel))
+	child := logger.With(zap.Namespace("req")).With(zap.String("id", "1"))
+	child.Info("first")
+	child.With(zap.Int("attempt", 2)).Info("second")
+
+	expected := "level=info msg=first req={id=1}\n" +
+		"level=info msg=second req={id=1 attempt=2}\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("Expected %q, got: %q", expected, got)
+	}
+}
@@ -0,0 +1,731 @@
+package zaptext
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Record is a log entry decoded by a Parser.
+type Record struct {
+	Time       time.Time
+	Level      zapcore.Level
+	LoggerName string
+	Caller     string
+	Function   string
+	Message    string
+	// Fields holds the fields of the entry in the order they were written,
+	// including the context added through With. Namespaces opened with
+	// key prefixes are part of the keys; nested namespaces are objects.
+	Fields []Field
+	Stack  string
+}
+
+// Field is a key=value pair of a Record or of an object value.
+type Field struct {
+	Key   string
+	Value Value
+}
+
+// ValueKind is the type of a Value. The text format doesn't record the types
+// of values, so they are inferred from the syntax: quoted values are strings,
+// unquoted ones are numbers, booleans or null when they look like one.
+type ValueKind uint8
+
+const (
+	// StringKind is a quoted value or an unquoted one of no other kind.
+	StringKind ValueKind = iota
+	// NumberKind is an unquoted integer or floating point number.
+	NumberKind
+	// BoolKind is an unquoted true or false.
+	BoolKind
+	// NullKind is an unquoted null, written for nil reflected values.
+	NullKind
+	// ArrayKind is a bracketed list of values.
+	ArrayKind
+	// ObjectKind is a braced list of fields, written by ObjectMarshalers,
+	// nested namespaces and reflected maps and structs.
+	ObjectKind
+)
+
+// String returns the lowercase name of the kind.
+func (k ValueKind) String() string {
+	switch k {
+	case StringKind:
+		return "string"
+	case NumberKind:
+		return "number"
+	case BoolKind:
+		return "bool"
+	case NullKind:
+		return "null"
+	case ArrayKind:
+		return "array"
+	case ObjectKind:
+		return "object"
+	}
+	return fmt.Sprintf("ValueKind(%d)", k)
+}
+
+// Value is a field value decoded by a Parser.
+type Value struct {
+	Kind ValueKind
+	// Text holds the unescaped content of a string, the literal of other
+	// scalars and the source text of arrays and objects.
+	Text   string
+	Elems  []Value // the elements of an array
+	Fields []Field // the fields of an object
+}
+
+// Int parses the text of v as a base 10 integer.
+func (v Value) Int() (int64, error) {
+	return strconv.ParseInt(v.Text, 10, 64)
+}
+
+// Float parses the text of v as a floating point number.
+func (v Value) Float() (float64, error) {
+	return strconv.ParseFloat(v.Text, 64)
+}
+
+// Bool parses the text of v as a boolean.
+func (v Value) Bool() (bool, error) {
+	return strconv.ParseBool(v.Text)
+}
+
+// Time parses v as a timestamp written by one of zap's time encoders: an
+// epoch number in seconds, milliseconds or nanoseconds, told apart by its
+// magnitude, or an RFC 3339 or ISO 8601 string.
+func (v Value) Time() (time.Time, error) {
+	if v.Kind == NumberKind {
+		return parseEpoch(v.Text)
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, v.Text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time: %q", v.Text)
+}
+
+// A Parser decodes lines written by a TextEncoder back into Records. It must
+// be configured like the encoder: header tokens are found by the keys of the
+// zapcore.EncoderConfig, and keys and values are unescaped according to the
+// options.
+//
+// Lines round trip as long as values are quoted when needed and bare header
+// tokens don't contain spaces or '='. Bare header tokens are identified by
+// position, so a bare logger name is only recognized when it's followed by a
+// caller, or when the encoder doesn't write callers at all, and a bare
+// function name must contain a dot; keyed headers, or strict logfmt mode,
+// avoid that ambiguity. Messages written with SanitizeReplace lose their
+// leading and trailing spaces.
+type Parser struct {
+	cfg        zapcore.EncoderConfig
+	opts       textOptions
+	timeLayout string
+}
+
+// NewParser creates a Parser for the output of a TextEncoder created with the
+// same cfg and opts.
+func NewParser(cfg zapcore.EncoderConfig, opts ...Option) *Parser {
+	enc := NewTextEncoderWithOptions(cfg, opts...).(*TextEncoder)
+	p := &Parser{cfg: *enc.EncoderConfig, opts: enc.opts}
+	enc.buf.Free()
+	return p
+}
+
+// SetTimeLayout configures the layout of the timestamps written by a custom
+// zapcore.TimeEncoder, e.g. one made by CustomTimeEncoderFactory. RFC 3339,
+// ISO 8601 and epoch timestamps are recognized without it.
+func (p *Parser) SetTimeLayout(layout string) {
+	p.timeLayout = layout
+}
+
+// Parse decodes an entry written by TextEncoder.EncodeEntry, including the
+// continuation lines of a multiline stack trace. A trailing line ending and
+// ANSI color codes are ignored.
+func (p *Parser) Parse(entry string) (Record, error) {
+	sep := p.cfg.LineEnding
+	if sep == "" {
+		sep = zapcore.DefaultLineEnding
+	}
+	entry = stripANSI(strings.TrimSuffix(entry, sep))
+	var stack []string
+	if i := strings.Index(entry, sep+"\t"); i >= 0 {
+		stack = strings.Split(entry[i+len(sep):], sep)
+		entry = entry[:i]
+	}
+	return p.parse(entry, stack)
+}
+
+// parse decodes the first line of an entry and its continuation lines.
+func (p *Parser) parse(line string, stack []string) (Record, error) {
+	var rec Record
+	tokens, err := p.tokenize(line)
+	if err != nil {
+		return rec, err
+	}
+
+	i := 0
+	keyed := func(key string) bool {
+		return key != "" && i < len(tokens) && tokens[i].keyed && tokens[i].key == key
+	}
+	bare := func(offset int) bool {
+		return i+offset < len(tokens) && !tokens[i+offset].keyed
+	}
+
+	if keyed(p.cfg.TimeKey) {
+		if rec.Time, err = p.parseTime(tokens[i].value); err != nil {
+			return rec, err
+		}
+		i++
+	}
+
+	if p.cfg.LevelKey != "" {
+		var level string
+		switch {
+		case p.keyedHeader(p.opts.keyedLevel) && keyed(p.cfg.LevelKey):
+			level = tokens[i].value.Text
+		case !p.keyedHeader(p.opts.keyedLevel) && bare(0):
+			level = tokens[i].text(line)
+		}
+		if level != "" {
+			if err := rec.Level.UnmarshalText([]byte(stripANSI(level))); err != nil {
+				return rec, fmt.Errorf("unrecognized level: %q", level)
+			}
+			i++
+		}
+	}
+
+	keyedName, keyedCaller := p.keyedHeader(p.opts.keyedName), p.keyedHeader(p.opts.keyedCaller)
+	if p.cfg.NameKey != "" {
+		switch {
+		case keyedName && keyed(p.cfg.NameKey):
+			rec.LoggerName = tokens[i].value.Text
+			i++
+		case !keyedName && bare(0):
+			// Only take the token as a name when the caller confirms it's
+			// not the first word of the message.
+			var named bool
+			switch {
+			case p.cfg.CallerKey == "":
+				named = true
+			case keyedCaller:
+				named = i+1 < len(tokens) && tokens[i+1].keyed && tokens[i+1].key == p.cfg.CallerKey
+			default:
+				named = bare(1) && !looksLikeCaller(tokens[i].text(line)) && looksLikeCaller(tokens[i+1].text(line))
+			}
+			if named {
+				rec.LoggerName = tokens[i].text(line)
+				i++
+			}
+		}
+	}
+
+	if p.cfg.CallerKey != "" {
+		var found bool
+		switch {
+		case keyedCaller && keyed(p.cfg.CallerKey):
+			rec.Caller, found = tokens[i].value.Text, true
+		case !keyedCaller && bare(0) && looksLikeCaller(tokens[i].text(line)):
+			rec.Caller, found = tokens[i].text(line), true
+		}
+		if found {
+			i++
+			switch {
+			case keyedCaller && keyed(p.cfg.FunctionKey):
+				rec.Function = tokens[i].value.Text
+				i++
+			case !keyedCaller && p.cfg.FunctionKey != "" && bare(0) && strings.Contains(tokens[i].text(line), "."):
+				rec.Function = tokens[i].text(line)
+				i++
+			}
+		}
+	}
+
+	if p.cfg.MessageKey != "" {
+		if p.keyedHeader(p.opts.keyedMessage) {
+			if keyed(p.cfg.MessageKey) {
+				rec.Message = tokens[i].value.Text
+				i++
+			}
+		} else if bare(0) {
+			start := tokens[i].start
+			for bare(0) {
+				i++
+			}
+			rec.Message = p.decodeMessage(line[start:tokens[i-1].end])
+		}
+	}
+
+	for ; i < len(tokens); i++ {
+		tok := tokens[i]
+		if !tok.keyed {
+			return rec, fmt.Errorf("unexpected token %q at offset %d", tok.text(line), tok.start)
+		}
+		if i == len(tokens)-1 && len(stack) == 0 && tok.key == p.cfg.StacktraceKey && p.cfg.StacktraceKey != "" && tok.value.Kind == StringKind {
+			rec.Stack = tok.value.Text
+			break
+		}
+		rec.Fields = append(rec.Fields, Field{Key: tok.key, Value: tok.value})
+	}
+
+	if len(stack) > 0 {
+		for j, frame := range stack {
+			stack[j] = strings.TrimPrefix(strings.TrimSuffix(frame, "\r"), "\t")
+		}
+		rec.Stack = strings.Join(stack, "\n")
+	}
+	return rec, nil
+}
+
+// keyedHeader reports whether a header token configured with keyed is written
+// as a key=value pair.
+func (p *Parser) keyedHeader(keyed bool) bool {
+	return keyed || p.opts.strictLogfmt
+}
+
+// token is a top-level element of a line: either a key=value pair or a bare
+// header or message token spanning line[start:end].
+type token struct {
+	start, end int
+	keyed      bool
+	key        string
+	value      Value
+}
+
+func (t token) text(line string) string {
+	return line[t.start:t.end]
+}
+
+// tokenize splits line into its space separated tokens, decoding the keys and
+// values of key=value pairs.
+func (p *Parser) tokenize(line string) ([]token, error) {
+	l := &lexer{
+		s:            line,
+		quote:        p.opts.quoteChar(),
+		escapedKeys:  p.escapedKeys(),
+		quotedTokens: !p.opts.strictLogfmt && p.opts.sanitizePolicy == SanitizeQuote,
+	}
+	if p.opts.strictLogfmt {
+		l.quote, l.flat = '"', true
+	}
+	var tokens []token
+	for {
+		for l.pos < len(l.s) && l.s[l.pos] == ' ' {
+			l.pos++
+		}
+		if l.pos == len(l.s) {
+			return tokens, nil
+		}
+		tok, err := l.token()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if l.pos < len(l.s) && l.s[l.pos] != ' ' {
+			return nil, l.errorf("unexpected %q", l.s[l.pos])
+		}
+	}
+}
+
+// escapedKeys reports whether keys and bare messages are written with
+// backslash escapes, i.e. by SanitizeEscape.
+func (p *Parser) escapedKeys() bool {
+	return !p.opts.strictLogfmt && p.opts.sanitizePolicy == SanitizeEscape
+}
+
+// decodeMessage decodes the raw text of a bare message according to the
+// SanitizePolicy it was written with.
+func (p *Parser) decodeMessage(raw string) string {
+	switch p.opts.sanitizePolicy {
+	case SanitizeEscape:
+		return unescape(raw)
+	case SanitizeQuote:
+		if len(raw) >= 2 && raw[0] == '"' {
+			l := &lexer{s: raw}
+			if s, err := l.quoted('"'); err == nil && l.pos == len(raw) {
+				return s
+			}
+		}
+	}
+	return raw
+}
+
+// timeLayouts are the layouts of the time encoders that come with zap.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.000Z0700"}
+
+// parseTime decodes a timestamp written by one of zap's time encoders, or by
+// one using the layout configured with SetTimeLayout.
+func (p *Parser) parseTime(v Value) (time.Time, error) {
+	if p.timeLayout != "" && v.Kind != NumberKind {
+		if t, err := time.Parse(p.timeLayout, v.Text); err == nil {
+			return t, nil
+		}
+	}
+	return v.Time()
+}
+
+// parseEpoch decodes the output of zap's epoch time encoders, telling
+// seconds, milliseconds and nanoseconds apart by their magnitude.
+func parseEpoch(s string) (time.Time, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && (n >= 1e14 || n <= -1e14) {
+		return time.Unix(0, n).UTC(), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unrecognized time: %q", s)
+	}
+	switch abs := math.Abs(f); {
+	case abs < 1e11:
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e9))).UTC(), nil
+	case abs < 1e14:
+		return time.UnixMicro(int64(math.Round(f * 1e3))).UTC(), nil
+	}
+	return time.Unix(0, int64(f)).UTC(), nil
+}
+
+// looksLikeCaller reports whether s is formatted like the output of zap's
+// caller encoders: a path followed by a line number, or "undefined".
+func looksLikeCaller(s string) bool {
+	if s == "undefined" {
+		return true
+	}
+	i := strings.LastIndexByte(s, ':')
+	if i <= 0 || i == len(s)-1 {
+		return false
+	}
+	for _, c := range s[i+1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// stripANSI removes the ANSI escape sequences written by colored level
+// encoders and by TextEncoder.SetColorMode. The encoder escapes the escape
+// character everywhere else, so no value can contain one.
+func stripANSI(s string) string {
+	if strings.IndexByte(s, 0x1b) < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0x1b && i+1 < len(s) && s[i+1] == '[' {
+			i += 2
+			for i < len(s) && (s[i] < 0x40 || s[i] > 0x7e) {
+				i++
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// lexer reads the tokens, keys and values of a line.
+type lexer struct {
+	s   string
+	pos int
+	// quote is the character that delimits quoted values besides '"', which
+	// reflected values always use.
+	quote byte
+	// escapedKeys is set when keys and bare tokens use backslash escapes.
+	escapedKeys bool
+	// quotedTokens is set when keys and bare messages may be quoted, i.e.
+	// with SanitizeQuote; otherwise a leading '"' is part of a bare token.
+	quotedTokens bool
+	// flat is set in strict logfmt mode, where values are scalars: a leading
+	// '[' or '{' is part of an unquoted value.
+	flat bool
+}
+
+func (l *lexer) errorf(format string, args ...any) error {
+	return fmt.Errorf("offset %d: %s", l.pos, fmt.Sprintf(format, args...))
+}
+
+// token reads a top-level key=value pair or bare token.
+func (l *lexer) token() (token, error) {
+	tok := token{start: l.pos}
+	if l.quotedTokens && l.s[l.pos] == '"' {
+		// A quoted key or message. Unbalanced quotes in a message are read
+		// as is.
+		if key, err := l.quoted('"'); err == nil {
+			if l.pos < len(l.s) && l.s[l.pos] == '=' {
+				return l.keyedToken(tok, key)
+			}
+			if l.pos == len(l.s) || l.s[l.pos] == ' ' {
+				tok.end = l.pos
+				return tok, nil
+			}
+		}
+		l.pos = tok.start
+	}
+	for l.pos < len(l.s) {
+		switch l.s[l.pos] {
+		case '\\':
+			if l.escapedKeys {
+				l.pos++
+			}
+		case ' ':
+			tok.end = l.pos
+			return tok, nil
+		case '=':
+			key := l.s[tok.start:l.pos]
+			if l.escapedKeys {
+				key = unescape(key)
+			}
+			return l.keyedToken(tok, key)
+		}
+		l.pos++
+	}
+	if l.pos > len(l.s) {
+		l.pos = len(l.s)
+	}
+	tok.end = l.pos
+	return tok, nil
+}
+
+// keyedToken reads the value of a top-level key=value pair, with l.pos at the
+// '='.
+func (l *lexer) keyedToken(tok token, key string) (token, error) {
+	l.pos++
+	value, err := l.value(" ")
+	if err != nil {
+		return tok, err
+	}
+	tok.keyed, tok.key, tok.value, tok.end = true, key, value, l.pos
+	return tok, nil
+}
+
+// value reads a value. Unquoted scalars end at any of the bytes in stop.
+func (l *lexer) value(stop string) (Value, error) {
+	if l.pos == len(l.s) {
+		return Value{Kind: StringKind}, nil
+	}
+	start := l.pos
+	switch c := l.s[l.pos]; {
+	case c == '"' || c == l.quote:
+		s, err := l.quoted(c)
+		return Value{Kind: StringKind, Text: s}, err
+	case c == '[' && !l.flat:
+		return l.array(start)
+	case c == '{' && !l.flat:
+		return l.object(start)
+	}
+	for l.pos < len(l.s) && strings.IndexByte(stop, l.s[l.pos]) < 0 {
+		l.pos++
+	}
+	return scalarValue(l.s[start:l.pos]), nil
+}
+
+// array reads a comma separated list of values between brackets.
+func (l *lexer) array(start int) (Value, error) {
+	v := Value{Kind: ArrayKind}
+	l.pos++
+	if l.pos < len(l.s) && l.s[l.pos] == ']' {
+		l.pos++
+		v.Text = l.s[start:l.pos]
+		return v, nil
+	}
+	for {
+		elem, err := l.value(",]")
+		if err != nil {
+			return v, err
+		}
+		v.Elems = append(v.Elems, elem)
+		if l.pos == len(l.s) {
+			return v, l.errorf("unterminated array")
+		}
+		switch l.s[l.pos] {
+		case ',':
+			l.pos++
+		case ']':
+			l.pos++
+			v.Text = l.s[start:l.pos]
+			return v, nil
+		default:
+			return v, l.errorf("unexpected %q in array", l.s[l.pos])
+		}
+	}
+}
+
+// object reads the fields between braces: space separated key=value pairs, or
+// the comma separated "key":value pairs of reflected maps and structs.
+func (l *lexer) object(start int) (Value, error) {
+	v := Value{Kind: ObjectKind}
+	l.pos++
+	for {
+		if l.pos == len(l.s) {
+			return v, l.errorf("unterminated object")
+		}
+		if l.s[l.pos] == '}' {
+			l.pos++
+			v.Text = l.s[start:l.pos]
+			return v, nil
+		}
+		if len(v.Fields) > 0 {
+			if c := l.s[l.pos]; c != ' ' && c != ',' {
+				return v, l.errorf("unexpected %q in object", c)
+			}
+			l.pos++
+		}
+		key, err := l.key()
+		if err != nil {
+			return v, err
+		}
+		value, err := l.value(" ,}")
+		if err != nil {
+			return v, err
+		}
+		v.Fields = append(v.Fields, Field{Key: key, Value: value})
+	}
+}
+
+// key reads the key of a field inside an object and the '=' or ':' that
+// follows it.
+func (l *lexer) key() (string, error) {
+	if l.pos < len(l.s) && l.s[l.pos] == '"' {
+		key, err := l.quoted('"')
+		if err != nil {
+			return "", err
+		}
+		if l.pos == len(l.s) || (l.s[l.pos] != '=' && l.s[l.pos] != ':') {
+			return "", l.errorf("missing separator after key %q", key)
+		}
+		l.pos++
+		return key, nil
+	}
+	start := l.pos
+	for ; l.pos < len(l.s); l.pos++ {
+		switch l.s[l.pos] {
+		case '\\':
+			if l.escapedKeys {
+				l.pos++
+			}
+		case '=':
+			key := l.s[start:l.pos]
+			if l.escapedKeys {
+				key = unescape(key)
+			}
+			l.pos++
+			return key, nil
+		case ' ', '}':
+			return "", l.errorf("missing '=' after key %q", l.s[start:l.pos])
+		}
+	}
+	return "", l.errorf("unterminated object")
+}
+
+// quoted reads a string delimited by q, undoing the escaping of safeAddString
+// and addQuoted.
+func (l *lexer) quoted(q byte) (string, error) {
+	start := l.pos
+	l.pos++
+	for i := l.pos; i < len(l.s); i++ {
+		switch l.s[i] {
+		case q:
+			s := l.s[l.pos:i]
+			l.pos = i + 1
+			if strings.IndexByte(s, '\\') >= 0 {
+				s = unescape(s)
+			}
+			return s, nil
+		case '\\':
+			i++
+		}
+	}
+	l.pos = start
+	return "", l.errorf("unterminated quoted string")
+}
+
+// scalarValue infers the kind of an unquoted value.
+func scalarValue(s string) Value {
+	v := Value{Kind: StringKind, Text: s}
+	switch {
+	case s == "true" || s == "false":
+		v.Kind = BoolKind
+	case s == "null":
+		v.Kind = NullKind
+	case s != "" && (s[0] == '-' || (s[0] >= '0' && s[0] <= '9')):
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			v.Kind = NumberKind
+		}
+	}
+	return v
+}
+
+// unescape decodes the backslash escapes written by safeAddString, addQuoted
+// and SanitizeEscape: JSON escape sequences, and a backslash followed by any
+// other character standing for that character.
+func unescape(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			r, n := decodeUnicodeEscape(s[i-1:])
+			if n == 0 {
+				b.WriteByte(c)
+				continue
+			}
+			b.WriteRune(r)
+			i += n - 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// decodeUnicodeEscape decodes the \uXXXX escape, or surrogate pair of
+// escapes, at the start of s and returns the rune and the number of bytes it
+// took. n is zero if s doesn't start with a valid escape.
+func decodeUnicodeEscape(s string) (r rune, n int) {
+	hex := func(s string) rune {
+		if len(s) < 6 || s[0] != '\\' || s[1] != 'u' {
+			return -1
+		}
+		v, err := strconv.ParseUint(s[2:6], 16, 16)
+		if err != nil {
+			return -1
+		}
+		return rune(v)
+	}
+	r = hex(s)
+	if r < 0 {
+		return 0, 0
+	}
+	if utf16.IsSurrogate(r) {
+		if r2 := hex(s[6:]); r2 >= 0 {
+			if dec := utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+				return dec, 12
+			}
+		}
+		return utf8.RuneError, 6
+	}
+	return r, 6
+}
@@ -0,0 +1,406 @@
+package zaptext_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/kaiiak/zaptext"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func parseTestConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:        "ts",
+		LevelKey:       "level",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		FunctionKey:    "func",
+		MessageKey:     "msg",
+		StacktraceKey:  "stacktrace",
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeLevel:    zapcore.CapitalLevelEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}
+}
+
+func str(s string) Value { return Value{Kind: StringKind, Text: s} }
+func num(s string) Value { return Value{Kind: NumberKind, Text: s} }
+
+func TestParserRoundTrip(t *testing.T) {
+	entry := zapcore.Entry{
+		Time:       time.Date(2024, 1, 2, 3, 4, 5, 6e6, time.UTC),
+		Level:      zap.WarnLevel,
+		LoggerName: "db",
+		Message:    `query "users" took a=b long`,
+		Caller:     zapcore.EntryCaller{Defined: true, File: "/src/app/main.go", Line: 3, Function: "main.main"},
+	}
+	fields := []zapcore.Field{
+		zap.String("plain", "value"),
+		zap.String("spaced", "a b\n\"c\""),
+		zap.String("empty", ""),
+		zap.Int("count", 42),
+		zap.Float64("ratio", 0.5),
+		zap.Bool("ok", true),
+		zap.Duration("elapsed", time.Second),
+		zap.Strings("tags", []string{"x", "y z"}),
+		zap.Object("user", testObject{name: "bob smith", count: 2, tags: []string{"admin"}}),
+		zap.Reflect("map", map[string]any{"k": []int{1, 2}, "n": nil}),
+	}
+	expectedFields := []Field{
+		{"plain", str("value")},
+		{"spaced", str("a b\n\"c\"")},
+		{"empty", str("")},
+		{"count", num("42")},
+		{"ratio", num("0.5")},
+		{"ok", Value{Kind: BoolKind, Text: "true"}},
+		{"elapsed", str("1s")},
+		{"tags", Value{Kind: ArrayKind, Text: `[x,"y z"]`, Elems: []Value{str("x"), str("y z")}}},
+		{"user", Value{Kind: ObjectKind, Text: `{name="bob smith" count=2 tags=[admin]}`, Fields: []Field{
+			{"name", str("bob smith")},
+			{"count", num("2")},
+			{"tags", Value{Kind: ArrayKind, Text: "[admin]", Elems: []Value{str("admin")}}},
+		}}},
+		{"map", Value{Kind: ObjectKind, Text: `{"k":[1,2],"n":null}`, Fields: []Field{
+			{"k", Value{Kind: ArrayKind, Text: "[1,2]", Elems: []Value{num("1"), num("2")}}},
+			{"n", Value{Kind: NullKind, Text: "null"}},
+		}}},
+	}
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Default"},
+		{name: "Keyed header", opts: []Option{WithKeyedLevel(true), WithKeyedName(true), WithKeyedCaller(true), WithKeyedMessage(true)}},
+		{name: "Quoted messages", opts: []Option{WithSanitizePolicy(SanitizeQuote)}},
+		{name: "Single quotes", opts: []Option{WithQuoteChar('\'')}},
+		{name: "Strict logfmt", opts: []Option{WithStrictLogfmt(true)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewTextEncoderWithOptions(parseTestConfig(), tt.opts...)
+			buf, err := enc.EncodeEntry(entry, fields)
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			line := buf.String()
+
+			rec, err := NewParser(parseTestConfig(), tt.opts...).Parse(line)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", line, err)
+			}
+			if !rec.Time.Equal(entry.Time) || rec.Level != entry.Level || rec.LoggerName != "db" ||
+				rec.Caller != "app/main.go:3" || rec.Function != "main.main" || rec.Message != entry.Message {
+				t.Errorf("Unexpected header in %q: %+v", line, rec)
+			}
+			if tt.name == "Strict logfmt" {
+				// Objects are flattened to strings holding their text
+				// format.
+				if v := rec.Fields[8].Value; v.Kind != StringKind || v.Text != expectedFields[8].Value.Text {
+					t.Errorf("Unexpected flattened object in %q: %+v", line, v)
+				}
+				return
+			}
+			got, want := rec.Fields, expectedFields
+			if tt.name == "Single quotes" {
+				// The source text of composite values keeps the quotes.
+				got, want = withoutSource(got), withoutSource(want)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Unexpected fields in %q:\n got: %+v\nwant: %+v", line, got, want)
+			}
+		})
+	}
+}
+
+// withoutSource clears the source text of the composite values in fields.
+func withoutSource(fields []Field) []Field {
+	out := make([]Field, len(fields))
+	for i, f := range fields {
+		out[i] = Field{Key: f.Key, Value: valueWithoutSource(f.Value)}
+	}
+	return out
+}
+
+func valueWithoutSource(v Value) Value {
+	if v.Kind != ArrayKind && v.Kind != ObjectKind {
+		return v
+	}
+	out := Value{Kind: v.Kind, Fields: withoutSource(v.Fields)}
+	for _, elem := range v.Elems {
+		out.Elems = append(out.Elems, valueWithoutSource(elem))
+	}
+	return out
+}
+
+func TestParserHeaders(t *testing.T) {
+	cfg := parseTestConfig()
+	cfg.EncodeTime = zapcore.EpochTimeEncoder
+	cfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	caller := zapcore.EntryCaller{Defined: true, File: "/src/app/main.go", Line: 3}
+
+	tests := []struct {
+		name     string
+		entry    zapcore.Entry
+		expected Record
+	}{
+		{
+			name:     "Unnamed without caller",
+			entry:    zapcore.Entry{Time: at, Level: zap.ErrorLevel, Message: "db down"},
+			expected: Record{Time: at, Level: zap.ErrorLevel, Message: "db down"},
+		},
+		{
+			name:     "Named with caller",
+			entry:    zapcore.Entry{Level: zap.InfoLevel, LoggerName: "db", Caller: caller, Message: "up"},
+			expected: Record{Level: zap.InfoLevel, LoggerName: "db", Caller: "app/main.go:3", Message: "up"},
+		},
+		{
+			name:     "Unnamed with caller",
+			entry:    zapcore.Entry{Level: zap.InfoLevel, Caller: caller, Message: "db up"},
+			expected: Record{Level: zap.InfoLevel, Caller: "app/main.go:3", Message: "db up"},
+		},
+		{
+			name:     "No message",
+			entry:    zapcore.Entry{Level: zap.DebugLevel},
+			expected: Record{Level: zap.DebugLevel, Fields: []Field{{"n", num("1")}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []zapcore.Field
+			if tt.expected.Fields != nil {
+				fields = []zapcore.Field{zap.Int("n", 1)}
+			}
+			enc := NewTextEncoder(cfg)
+			buf, err := enc.EncodeEntry(tt.entry, fields)
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			rec, err := NewParser(cfg).Parse(buf.String())
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", buf.String(), err)
+			}
+			if !reflect.DeepEqual(rec, tt.expected) {
+				t.Errorf("Parse(%q):\n got: %+v\nwant: %+v", buf.String(), rec, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParserStacktrace(t *testing.T) {
+	entry := zapcore.Entry{Level: zap.ErrorLevel, Message: "failed", Stack: "main.main\n\t/src/app/main.go:10"}
+	for _, format := range []StacktraceFormat{StacktraceField, StacktraceMultiline} {
+		enc := NewTextEncoderWithOptions(parseTestConfig(), WithStacktraceFormat(format))
+		buf, err := enc.EncodeEntry(entry, []zapcore.Field{zap.String("stacktrace", "not last")})
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		rec, err := NewParser(parseTestConfig(), WithStacktraceFormat(format)).Parse(buf.String())
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", buf.String(), err)
+		}
+		if rec.Stack != entry.Stack || len(rec.Fields) != 1 || rec.Fields[0].Value.Text != "not last" {
+			t.Errorf("Parse(%q) = %+v", buf.String(), rec)
+		}
+	}
+}
+
+func TestParserStrictLogfmtValues(t *testing.T) {
+	opts := []Option{WithStrictLogfmt(true)}
+	enc := NewTextEncoderWithOptions(parseTestConfig(), opts...)
+	buf, err := enc.EncodeEntry(zapcore.Entry{Level: zap.InfoLevel, Message: "m"}, []zapcore.Field{
+		zap.String("a", "[x"),
+		zap.String("b", "{y"),
+		zap.String("c", "x]"),
+	})
+	if err != nil {
+		t.Fatalf("EncodeEntry failed: %v", err)
+	}
+	line := buf.String()
+	if !strings.HasPrefix(line, "level=INFO msg=m a=[x b={y c=x]") {
+		t.Fatalf("Unexpected line: %q", line)
+	}
+
+	rec, err := NewParser(parseTestConfig(), opts...).Parse(line)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", line, err)
+	}
+	expected := []Field{{"a", str("[x")}, {"b", str("{y")}, {"c", str("x]")}}
+	if !reflect.DeepEqual(rec.Fields, expected) {
+		t.Errorf("Unexpected fields in %q:\n got: %+v\nwant: %+v", line, rec.Fields, expected)
+	}
+}
+
+func TestParserMessageSpaces(t *testing.T) {
+	messages := []string{"  indented", "trailing  ", " both ", "   "}
+	policies := []struct {
+		name   string
+		policy SanitizePolicy
+	}{
+		{"Escape", SanitizeEscape},
+		{"Quote", SanitizeQuote},
+	}
+	for _, pp := range policies {
+		t.Run(pp.name, func(t *testing.T) {
+			opts := []Option{WithSanitizePolicy(pp.policy)}
+			for _, msg := range messages {
+				enc := NewTextEncoderWithOptions(parseTestConfig(), opts...)
+				buf, err := enc.EncodeEntry(zapcore.Entry{Level: zap.InfoLevel, Message: msg}, []zapcore.Field{zap.Int("n", 1)})
+				if err != nil {
+					t.Fatalf("EncodeEntry failed: %v", err)
+				}
+				rec, err := NewParser(parseTestConfig(), opts...).Parse(buf.String())
+				if err != nil {
+					t.Fatalf("Parse(%q) failed: %v", buf.String(), err)
+				}
+				if rec.Message != msg || len(rec.Fields) != 1 {
+					t.Errorf("Expected message %q, got: %q from %q", msg, rec.Message, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestParserMessageQuotes(t *testing.T) {
+	messages := []string{`"`, `say " hi`, `"quoted" word`, `say "hi there"`, `say hi"`}
+	for _, policy := range []SanitizePolicy{SanitizeEscape, SanitizeQuote, SanitizeReplace} {
+		opts := []Option{WithSanitizePolicy(policy)}
+		for _, msg := range messages {
+			enc := NewTextEncoderWithOptions(parseTestConfig(), opts...)
+			buf, err := enc.EncodeEntry(zapcore.Entry{Level: zap.InfoLevel, Message: msg}, []zapcore.Field{zap.String("0", " ")})
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			rec, err := NewParser(parseTestConfig(), opts...).Parse(buf.String())
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", buf.String(), err)
+			}
+			expected := []Field{{"0", str(" ")}}
+			if rec.Message != msg || !reflect.DeepEqual(rec.Fields, expected) {
+				t.Errorf("Policy %v: expected message %q, got: %q with %+v from %q", policy, msg, rec.Message, rec.Fields, buf.String())
+			}
+		}
+	}
+}
+
+func TestValueTime(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 5e8, time.UTC)
+	tests := []struct {
+		name  string
+		value Value
+	}{
+		{"Seconds", num("1704164645.5")},
+		{"Milliseconds", num("1704164645500")},
+		{"Nanoseconds", num("1704164645500000000")},
+		{"RFC 3339", str("2024-01-02T03:04:05.500Z")},
+		{"ISO 8601", str("2024-01-02T03:04:05.500+0000")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.value.Time()
+			if err != nil {
+				t.Fatalf("Time() failed: %v", err)
+			}
+			if !got.Equal(at) {
+				t.Errorf("Expected %v, got: %v", at, got)
+			}
+		})
+	}
+	if _, err := str("yesterday").Time(); err == nil {
+		t.Errorf("Expected an error for an unrecognized time")
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	p := NewParser(parseTestConfig())
+	for _, line := range []string{
+		`INFO msg a="unterminated`,
+		`INFO msg a=[1,2`,
+		`INFO msg a={b=1`,
+		`INFO msg a={b}`,
+		`INFO msg a=1 stray`,
+		`NOTALEVEL msg`,
+		`ts=yesterday INFO msg`,
+	} {
+		if rec, err := p.Parse(line); err == nil {
+			t.Errorf("Parse(%q) = %+v, expected an error", line, rec)
+		}
+	}
+}
+
+func TestScanner(t *testing.T) {
+	cfg := parseTestConfig()
+	var out strings.Builder
+	enc := NewTextEncoderWithOptions(cfg, WithStacktraceFormat(StacktraceMultiline))
+	for _, ent := range []zapcore.Entry{
+		{Level: zap.InfoLevel, Message: "first"},
+		{Level: zap.ErrorLevel, Message: "second", Stack: "main.main\n\t/src/app/main.go:10"},
+		{Level: zap.InfoLevel, Message: "third"},
+	} {
+		buf, err := enc.EncodeEntry(ent, nil)
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		out.WriteString(buf.String())
+		if ent.Message == "second" {
+			out.WriteString("\nNOTALEVEL garbage\r\n")
+		}
+	}
+
+	s := NewScanner(strings.NewReader(out.String()), NewParser(cfg))
+	var messages []string
+	var errs int
+	for s.Scan() {
+		rec, err := s.Record()
+		if err != nil {
+			errs++
+			if s.Text() != "NOTALEVEL garbage" {
+				t.Errorf("Unexpected text of a bad entry: %q", s.Text())
+			}
+			continue
+		}
+		messages = append(messages, rec.Message)
+		if rec.Message == "second" && rec.Stack != "main.main\n\t/src/app/main.go:10" {
+			t.Errorf("Unexpected stack: %q", rec.Stack)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+	if !reflect.DeepEqual(messages, []string{"first", "second", "third"}) || errs != 1 {
+		t.Errorf("Scanned %q with %d errors", messages, errs)
+	}
+}
+
+func TestScannerColors(t *testing.T) {
+	cfg := parseTestConfig()
+	cfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	opts := []Option{WithColorMode(ColorAlways), WithStacktraceFormat(StacktraceMultiline)}
+	enc := NewTextEncoderWithOptions(cfg, opts...)
+	entry := zapcore.Entry{Level: zap.ErrorLevel, Message: "failed", Stack: "main.main\n\t/src/app/main.go:10"}
+	buf, err := enc.EncodeEntry(entry, []zapcore.Field{zap.String("user", "bob"), zap.Int("n", 1)})
+	if err != nil {
+		t.Fatalf("EncodeEntry failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\x1b[") {
+		t.Fatalf("Expected colored output, got: %q", buf.String())
+	}
+
+	s := NewScanner(strings.NewReader(buf.String()), NewParser(cfg, opts...))
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	rec, err := s.Record()
+	if err != nil {
+		t.Fatalf("Record of %q failed: %v", s.Text(), err)
+	}
+	expected := []Field{{"user", str("bob")}, {"n", num("1")}}
+	if rec.Level != zap.ErrorLevel || rec.Message != "failed" || rec.Stack != entry.Stack || !reflect.DeepEqual(rec.Fields, expected) {
+		t.Errorf("Unexpected record from %q: %+v", s.Text(), rec)
+	}
+}
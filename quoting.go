@@ -0,0 +1,106 @@
+package zaptext
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// QuotePolicy selects when TextEncoder quotes string values: fields added
+// with AddString and AppendString, durations and times encoded as strings,
+// and reflected values that aren't numbers or booleans. Quoted values are
+// escaped so that they can't break the line; unquoted ones still have their
+// control characters and invalid UTF-8 escaped.
+type QuotePolicy int8
+
+const (
+	// QuoteWhenNeeded quotes values that are empty or contain spaces, control
+	// characters, quote characters or the characters that delimit keys, arrays
+	// and objects. This is the default. Reflected arrays, maps and structs are written as is.
+	QuoteWhenNeeded QuotePolicy = iota
+	// QuoteAlways quotes every string value.
+	QuoteAlways
+	// QuoteNever never quotes values, which keeps them grep-friendly at the
+	// cost of ambiguity when they contain spaces or '='.
+	QuoteNever
+)
+
+// shouldQuote reports whether value is quoted according to the configured
+// predicate or QuotePolicy.
+func (opts *textOptions) shouldQuote(value string) bool {
+	if opts.quotePredicate != nil {
+		return opts.quotePredicate(value)
+	}
+	switch opts.quotePolicy {
+	case QuoteAlways:
+		return true
+	case QuoteNever:
+		return false
+	}
+	q := opts.quoteChar()
+	return needsQuoting(value) || (q != '"' && strings.IndexByte(value, q) >= 0)
+}
+
+// quoteChar returns the configured quote character, '"' by default.
+func (opts *textOptions) quoteChar() byte {
+	if opts.quote == 0 {
+		return '"'
+	}
+	return opts.quote
+}
+
+// isValidQuoteChar reports whether c can delimit quoted values: a printable
+// ASCII character that doesn't have another meaning in the text format.
+func isValidQuoteChar(c byte) bool {
+	switch c {
+	case '\\', ' ', '=', '{', '}', '[', ']', ',':
+		return false
+	}
+	return c > ' ' && c < utf8.RuneSelf && c != 0x7f
+}
+
+// addQuoted writes value between quote characters, escaping backslashes, the
+// quote character and control characters.
+func (enc *TextEncoder) addQuoted(value string) {
+	q := enc.opts.quoteChar()
+	enc.buf.AppendByte(q)
+	if q == '"' {
+		enc.safeAddString(value)
+	} else {
+		for i := 0; i < len(value); i++ {
+			switch b := value[i]; b {
+			case q:
+				enc.buf.AppendByte('\\')
+				enc.buf.AppendByte(q)
+			case '"':
+				enc.buf.AppendByte('"')
+			default:
+				if !enc.tryAddRuneSelf(b) {
+					r, size := utf8.DecodeRuneInString(value[i:])
+					if !enc.tryAddRuneError(r, size) {
+						enc.buf.AppendString(value[i : i+size])
+					}
+					i += size - 1
+				}
+			}
+		}
+	}
+	enc.buf.AppendByte(q)
+}
+
+// addUnquoted writes value without quotes, escaping only control characters
+// and invalid UTF-8 so that the value can't break the line.
+func (enc *TextEncoder) addUnquoted(value string) {
+	for i := 0; i < len(value); {
+		r, size := utf8.DecodeRuneInString(value[i:])
+		switch {
+		case enc.tryAddRuneError(r, size):
+		case r < 0x20:
+			enc.tryAddRuneSelf(byte(r))
+		case r == 0x7f:
+			enc.buf.AppendString(`\u007f`)
+		default:
+			enc.buf.AppendString(value[i : i+size])
+		}
+		i += size
+	}
+}
@@ -0,0 +1,111 @@
+package zaptext_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/kaiiak/zaptext"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTextEncoderQuoting(t *testing.T) {
+	fields := []zapcore.Field{
+		zap.String("plain", "value"),
+		zap.String("spaced", "a b"),
+		zap.String("quoted", `it's "x"`),
+		zap.String("newline", "a\nb"),
+		zap.Strings("tags", []string{"x", "y z"}),
+		zap.Duration("elapsed", time.Second),
+		zap.Time("at", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)),
+		zap.Reflect("map", map[string]int{"n": 1}),
+		zap.Reflect("num", 42),
+	}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected string
+	}{
+		{
+			name:     "When needed",
+			expected: `plain=value spaced="a b" quoted="it's \"x\"" newline="a\nb" tags=[x,"y z"] elapsed=1s at="2024-01-02T03:04:05Z" map={"n":1} num=42`,
+		},
+		{
+			name:     "Always",
+			opts:     []Option{WithQuotePolicy(QuoteAlways)},
+			expected: `plain="value" spaced="a b" quoted="it's \"x\"" newline="a\nb" tags=["x","y z"] elapsed="1s" at="2024-01-02T03:04:05Z" map="{\"n\":1}" num=42`,
+		},
+		{
+			name:     "Never",
+			opts:     []Option{WithQuotePolicy(QuoteNever)},
+			expected: `plain=value spaced=a b quoted=it's "x" newline=a\nb tags=[x,y z] elapsed=1s at=2024-01-02T03:04:05Z map={"n":1} num=42`,
+		},
+		{
+			name: "Predicate",
+			opts: []Option{
+				WithQuotePolicy(QuoteNever),
+				WithQuotePredicate(func(value string) bool { return strings.HasPrefix(value, "a") }),
+			},
+			expected: `plain=value spaced="a b" quoted=it's "x" newline="a\nb" tags=[x,y z] elapsed=1s at=2024-01-02T03:04:05Z map={"n":1} num=42`,
+		},
+		{
+			name:     "Single quotes",
+			opts:     []Option{WithQuoteChar('\'')},
+			expected: `plain=value spaced='a b' quoted='it\'s "x"' newline='a\nb' tags=[x,'y z'] elapsed=1s at='2024-01-02T03:04:05Z' map={"n":1} num=42`,
+		},
+		{
+			name:     "Invalid quote character",
+			opts:     []Option{WithQuoteChar('=')},
+			expected: `plain=value spaced="a b" quoted="it's \"x\"" newline="a\nb" tags=[x,"y z"] elapsed=1s at="2024-01-02T03:04:05Z" map={"n":1} num=42`,
+		},
+		{
+			name:     "Config",
+			opts:     []Option{Config{QuotePolicy: QuoteAlways, QuoteChar: "'"}},
+			expected: `plain='value' spaced='a b' quoted='it\'s "x"' newline='a\nb' tags=['x','y z'] elapsed='1s' at='2024-01-02T03:04:05Z' map='{"n":1}' num=42`,
+		},
+		{
+			name:     "Strict logfmt ignores the policy",
+			opts:     []Option{WithQuotePolicy(QuoteAlways), WithQuoteChar('\''), WithStrictLogfmt(true)},
+			expected: `plain=value spaced="a b" quoted="it's \"x\"" newline="a\nb" tags="[x,\"y z\"]" elapsed=1s at=2024-01-02T03:04:05Z map="{\"n\":1}" num=42`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewTextEncoderWithOptions(zapcore.EncoderConfig{EncodeDuration: zapcore.StringDurationEncoder}, tt.opts...)
+			buf, err := enc.EncodeEntry(zapcore.Entry{}, fields)
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			expected := tt.expected + "\n"
+			if got := buf.String(); got != expected {
+				t.Errorf("Expected %q, got: %q", expected, got)
+			}
+		})
+	}
+}
+
+func TestTextEncoderUnquotedArrayElements(t *testing.T) {
+	enc := NewTextEncoderWithOptions(zapcore.EncoderConfig{}, WithQuotePolicy(QuoteNever))
+	buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{
+		zap.Strings("a", []string{"x{", "y", "[", "z"}),
+		zap.Strings("b", []string{}),
+		zap.Array("c", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			arr.AppendString("[")
+			if err := arr.AppendArray(zapcore.ArrayMarshalerFunc(func(zapcore.ArrayEncoder) error { return nil })); err != nil {
+				return err
+			}
+			arr.AppendString("{")
+			return nil
+		})),
+	})
+	if err != nil {
+		t.Fatalf("EncodeEntry failed: %v", err)
+	}
+	expected := "a=[x{,y,[,z] b=[] c=[[,[],{]\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("Expected %q, got: %q", expected, got)
+	}
+}
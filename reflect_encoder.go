@@ -5,19 +5,24 @@ package zaptext
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/json"
 	"fmt"
 	"io"
 	"reflect"
-	"sort"
-	"strconv"
-	"strings"
 	"sync"
-	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/zapcore"
 )
 
 const (
 	// DefaultMaxDepth is the default maximum recursion depth to prevent infinite loops
 	DefaultMaxDepth = 32
+
+	// CycleMarker is written in place of a pointer, map or slice that refers
+	// back to a value being encoded, unless SetFailOnCycle is enabled.
+	CycleMarker = `"<cycle>"`
 )
 
 var (
@@ -41,6 +46,18 @@ var (
 // infinite recursion. The encoder handles all Go primitive types, compound types (arrays,
 // slices, maps, structs), and special cases like time.Time formatting.
 //
+// Values that know how to encode themselves are encoded with the first of these
+// methods they implement: zapcore.ObjectMarshaler, zapcore.ArrayMarshaler,
+// json.Marshaler, encoding.TextMarshaler, error and fmt.Stringer. As in
+// encoding/json, methods with a pointer receiver are only used for addressable
+// values. An error returned by one of these methods, or a panic in it, fails
+// the encoding.
+//
+// Pointers, maps and slices that refer back to a value on the path being
+// encoded, such as a child pointing to its parent, are written as CycleMarker,
+// so that cyclic data stops at the repeat point rather than at the maximum
+// depth.
+//
 // Example usage:
 //
 //	encoder := zaptext.NewReflectEncoder(os.Stdout)
@@ -53,7 +70,11 @@ type ReflectEncoder struct {
 	depth      int
 	maxDepth   int
 
-	buf *bytes.Buffer
+	failOnCycle bool
+	path        map[pathKey]struct{} // the pointers, maps and slices being encoded
+
+	buf     *bytes.Buffer
+	scratch [64]byte // for appending numbers to buf
 }
 
 // NewReflectEncoder creates a new ReflectEncoder from the object pool.
@@ -65,6 +86,7 @@ func NewReflectEncoder(w io.Writer) *ReflectEncoder {
 	enc.escapeHTML = true
 	enc.depth = 0
 	enc.maxDepth = DefaultMaxDepth // Default maximum depth to prevent infinite recursion
+	enc.failOnCycle = false
 	enc.err = nil
 
 	if enc.buf == nil {
@@ -77,13 +99,19 @@ func NewReflectEncoder(w io.Writer) *ReflectEncoder {
 
 // SetMaxDepth configures the maximum recursion depth to prevent infinite loops.
 // The default value is 32. Setting a lower value may prevent encoding of deeply
-// nested structures, while higher values may risk stack overflow with circular references.
+// nested structures. Cyclic data is detected regardless of the depth.
 func (enc *ReflectEncoder) SetMaxDepth(depth int) {
 	if depth > 0 {
 		enc.maxDepth = depth
 	}
 }
 
+// SetFailOnCycle configures whether a cycle fails the encoding with an error
+// instead of being written as CycleMarker. It's disabled by default.
+func (enc *ReflectEncoder) SetFailOnCycle(fail bool) {
+	enc.failOnCycle = fail
+}
+
 // SetEscapeHTML configures whether to escape HTML characters in strings.
 // When enabled (default), characters like <, >, and & are escaped to their HTML entities.
 // This is useful when the output might be embedded in HTML documents.
@@ -103,6 +131,7 @@ func (enc *ReflectEncoder) Release() {
 	enc.err = nil
 	enc.depth = 0
 	enc.maxDepth = DefaultMaxDepth // Reset to default
+	enc.failOnCycle = false
 	reflectEncoderPool.Put(enc)
 }
 
@@ -125,6 +154,8 @@ func (enc *ReflectEncoder) Encode(obj any) error {
 
 	// Encode the object using reflection
 	if err := enc.encodeValue(reflect.ValueOf(obj)); err != nil {
+		// The path is only left as is on errors.
+		clear(enc.path)
 		enc.err = err
 		return err
 	}
@@ -137,11 +168,10 @@ func (enc *ReflectEncoder) Encode(obj any) error {
 
 	return nil
 }
-
 func (enc *ReflectEncoder) encodeValue(v reflect.Value) error {
 	// Prevent infinite recursion
-	if enc.depth > enc.maxDepth {
-		return fmt.Errorf("maximum encoding depth exceeded: %d", enc.maxDepth)
+	if err := enc.checkDepth(); err != nil {
+		return err
 	}
 
 	// Handle invalid values
@@ -150,237 +180,261 @@ func (enc *ReflectEncoder) encodeValue(v reflect.Value) error {
 		return nil
 	}
 
-	// Handle pointers and interfaces
-	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
-		if v.IsNil() {
-			enc.buf.WriteString("null")
-			return nil
-		}
-		v = v.Elem()
-	}
-
-	switch v.Kind() {
-	case reflect.Bool:
-		if v.Bool() {
-			enc.buf.WriteString("true")
-		} else {
-			enc.buf.WriteString("false")
-		}
-
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		enc.buf.WriteString(strconv.FormatInt(v.Int(), 10))
-
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		enc.buf.WriteString(strconv.FormatUint(v.Uint(), 10))
-
-	case reflect.Float32, reflect.Float64:
-		f := v.Float()
-		enc.buf.WriteString(strconv.FormatFloat(f, 'g', -1, v.Type().Bits()))
-
-	case reflect.Complex64, reflect.Complex128:
-		c := v.Complex()
-		// Use JSON-compatible format: {"real": 1.0, "imag": 2.0}
-		enc.buf.WriteByte('{')
-		enc.buf.WriteString(`"real":`)
-		enc.buf.WriteString(strconv.FormatFloat(real(c), 'g', -1, 64))
-		enc.buf.WriteString(`,"imag":`)
-		enc.buf.WriteString(strconv.FormatFloat(imag(c), 'g', -1, 64))
-		enc.buf.WriteByte('}')
+	return typeEncoder(v.Type())(enc, v)
+}
 
-	case reflect.String:
-		enc.buf.WriteByte('"')
-		enc.writeEscapedString(v.String())
-		enc.buf.WriteByte('"')
+// checkDepth fails once values are nested deeper than the maximum depth.
+func (enc *ReflectEncoder) checkDepth() error {
+	if enc.depth > enc.maxDepth {
+		return fmt.Errorf("maximum encoding depth exceeded: %d", enc.maxDepth)
+	}
+	return nil
+}
 
-	case reflect.Array, reflect.Slice:
-		if v.IsNil() {
-			enc.buf.WriteString("null")
-			return nil
-		}
-		return enc.encodeArray(v)
+// pathKey identifies a pointer, map or slice on the path being encoded. The
+// type tells a struct apart from its first field, and the length a slice from
+// its prefixes.
+type pathKey struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
 
-	case reflect.Map:
-		if v.IsNil() {
-			enc.buf.WriteString("null")
-			return nil
+// enter adds v, a non-nil pointer, map or slice, to the path being encoded.
+// It reports false if v is already on it, after writing CycleMarker or
+// returning the error of a cycle.
+func (enc *ReflectEncoder) enter(v reflect.Value) (pathKey, bool, error) {
+	key := pathKey{typ: v.Type(), ptr: v.Pointer()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+	if _, ok := enc.path[key]; ok {
+		if enc.failOnCycle {
+			return key, false, fmt.Errorf("encountered a cycle via %v", key.typ)
 		}
-		return enc.encodeMap(v)
-
-	case reflect.Struct:
-		return enc.encodeStruct(v)
-
-	default:
-		// For types we don't handle specifically, try to convert to string
-		enc.encodeString(fmt.Sprintf("%v", v.Interface()))
+		enc.buf.WriteString(CycleMarker)
+		return key, false, nil
 	}
+	if enc.path == nil {
+		// Kept across Release, since it's empty after each Encode.
+		enc.path = make(map[pathKey]struct{})
+	}
+	enc.path[key] = struct{}{}
+	return key, true, nil
+}
 
-	return nil
+// leave removes the value added by enter from the path.
+func (enc *ReflectEncoder) leave(key pathKey) {
+	delete(enc.path, key)
 }
 
 func (enc *ReflectEncoder) encodeString(s string) {
 	if needsQuoting(s) {
-		enc.buf.WriteByte('"')
-		enc.writeEscapedString(s)
-		enc.buf.WriteByte('"')
+		enc.writeQuotedString(s)
 	} else {
 		enc.buf.WriteString(s)
 	}
 }
 
+func (enc *ReflectEncoder) writeQuotedString(s string) {
+	enc.buf.WriteByte('"')
+	enc.writeEscapedString(s)
+	enc.buf.WriteByte('"')
+}
+
+// writeEscapedString writes s escaped for a JSON string. Runs of characters
+// that need no escaping are copied at once, and invalid UTF-8 is replaced
+// with U+FFFD.
 func (enc *ReflectEncoder) writeEscapedString(s string) {
-	for _, r := range s {
-		switch r {
-		case '"':
-			enc.buf.WriteString(`\"`)
-		case '\\':
-			enc.buf.WriteString(`\\`)
-		case '\n':
-			enc.buf.WriteString(`\n`)
-		case '\r':
-			enc.buf.WriteString(`\r`)
-		case '\t':
-			enc.buf.WriteString(`\t`)
-		case '<':
-			if enc.escapeHTML {
-				enc.buf.WriteString(`\u003c`)
-			} else {
-				enc.buf.WriteRune(r)
-			}
-		case '>':
-			if enc.escapeHTML {
-				enc.buf.WriteString(`\u003e`)
-			} else {
-				enc.buf.WriteRune(r)
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && (!enc.escapeHTML || (c != '<' && c != '>' && c != '&')) {
+				i++
+				continue
 			}
-		case '&':
-			if enc.escapeHTML {
-				enc.buf.WriteString(`\u0026`)
-			} else {
-				enc.buf.WriteRune(r)
+			enc.buf.WriteString(s[start:i])
+			switch c {
+			case '"':
+				enc.buf.WriteString(`\"`)
+			case '\\':
+				enc.buf.WriteString(`\\`)
+			case '\n':
+				enc.buf.WriteString(`\n`)
+			case '\r':
+				enc.buf.WriteString(`\r`)
+			case '\t':
+				enc.buf.WriteString(`\t`)
+			default:
+				// Other control characters, and <, > and & when escaping HTML
+				enc.buf.WriteString(`\u00`)
+				enc.buf.WriteByte(hexDigits[c>>4])
+				enc.buf.WriteByte(hexDigits[c&0xf])
 			}
-		default:
-			if r < 32 {
-				enc.buf.WriteString(fmt.Sprintf(`\u%04x`, r))
-			} else {
-				enc.buf.WriteRune(r)
-			}
-		}
-	}
-}
-
-func (enc *ReflectEncoder) encodeArray(v reflect.Value) error {
-	enc.buf.WriteByte('[')
-
-	enc.depth++
-	defer func() { enc.depth-- }()
-
-	length := v.Len()
-	for i := 0; i < length; i++ {
-		if i > 0 {
-			enc.buf.WriteByte(',')
+			i++
+			start = i
+			continue
 		}
-		if err := enc.encodeValue(v.Index(i)); err != nil {
-			return err
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			enc.buf.WriteString(s[start:i])
+			enc.buf.WriteRune(utf8.RuneError)
+			i++
+			start = i
+			continue
 		}
+		i += size
 	}
-
-	enc.buf.WriteByte(']')
-	return nil
+	enc.buf.WriteString(s[start:])
 }
 
-func (enc *ReflectEncoder) encodeMap(v reflect.Value) error {
-	enc.buf.WriteByte('{')
-
-	enc.depth++
-	defer func() { enc.depth-- }()
-
-	keys := v.MapKeys()
+const hexDigits = "0123456789abcdef"
 
-	// Sort keys for deterministic output
-	sort.Slice(keys, func(i, j int) bool {
-		return fmt.Sprintf("%v", keys[i].Interface()) < fmt.Sprintf("%v", keys[j].Interface())
-	})
-
-	for i, key := range keys {
-		if i > 0 {
-			enc.buf.WriteByte(',')
+// encodeQuoted writes a value tagged with the string option as a JSON string
+// holding its JSON encoding, like encoding/json does.
+func (enc *ReflectEncoder) encodeQuoted(v reflect.Value) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			enc.buf.WriteString("null")
+			return nil
 		}
-
-		// Encode key
-		keyStr := fmt.Sprintf("%v", key.Interface())
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.String {
 		enc.buf.WriteByte('"')
-		enc.buf.WriteString(keyStr)
+		err := enc.encodeValue(v)
 		enc.buf.WriteByte('"')
-		enc.buf.WriteByte(':')
-
-		// Encode value
-		if err := enc.encodeValue(v.MapIndex(key)); err != nil {
-			return err
-		}
+		return err
 	}
 
-	enc.buf.WriteByte('}')
+	start := enc.buf.Len()
+	if err := enc.encodeValue(v); err != nil {
+		return err
+	}
+	encoded := string(enc.buf.Bytes()[start:])
+	enc.buf.Truncate(start)
+	enc.writeQuotedString(encoded)
 	return nil
 }
 
-func (enc *ReflectEncoder) encodeStruct(v reflect.Value) error {
-	t := v.Type()
-
-	// Handle time.Time specially
-	if t == reflect.TypeOf(time.Time{}) {
-		timeVal := v.Interface().(time.Time)
-		enc.encodeString(timeVal.Format(time.RFC3339))
-		return nil
-	}
+// marshalerKind identifies the method a value encodes itself with.
+type marshalerKind uint8
 
-	enc.buf.WriteByte('{')
-
-	enc.depth++
-	defer func() { enc.depth-- }()
+const (
+	noMarshaler marshalerKind = iota
+	objectMarshaler
+	arrayMarshaler
+	jsonMarshaler
+	textMarshaler
+	errorMarshaler
+	stringerMarshaler
+)
 
-	fieldCount := 0
-	for i := 0; i < v.NumField(); i++ {
-		field := t.Field(i)
-		fieldValue := v.Field(i)
+// marshalerTypes lists the interfaces of the marshaler kinds, in order of
+// preference.
+var marshalerTypes = [...]reflect.Type{
+	objectMarshaler:   reflect.TypeOf((*zapcore.ObjectMarshaler)(nil)).Elem(),
+	arrayMarshaler:    reflect.TypeOf((*zapcore.ArrayMarshaler)(nil)).Elem(),
+	jsonMarshaler:     reflect.TypeOf((*json.Marshaler)(nil)).Elem(),
+	textMarshaler:     reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem(),
+	errorMarshaler:    reflect.TypeOf((*error)(nil)).Elem(),
+	stringerMarshaler: reflect.TypeOf((*fmt.Stringer)(nil)).Elem(),
+}
 
-		// Skip unexported fields - these cannot be accessed via reflection and would cause errors
-		if !field.IsExported() {
-			continue
+// marshalerOf returns the preferred marshaler kind implemented by t.
+func marshalerOf(t reflect.Type) marshalerKind {
+	for kind := objectMarshaler; int(kind) < len(marshalerTypes); kind++ {
+		if t.Implements(marshalerTypes[kind]) {
+			return kind
 		}
+	}
+	return noMarshaler
+}
 
-		// Skip nil pointers to avoid encoding null fields in structs
-		// This creates cleaner output by omitting optional fields that are not set
-		if fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil() {
-			continue
+// encodeMarshaler encodes v with its marshaling method. Since the cases are in
+// the order of preference, the method used is the one marshalerOf picks for
+// the type of v. Error messages name t, the type v was found as.
+func (enc *ReflectEncoder) encodeMarshaler(v reflect.Value, t reflect.Type) error {
+	switch m := v.Interface().(type) {
+	case zapcore.ObjectMarshaler:
+		fields := &marshalerEncoder{enc: enc}
+		return callMarshaler(t, "MarshalLogObject", func() error { return fields.object(m) })
+
+	case zapcore.ArrayMarshaler:
+		elems := &marshalerEncoder{enc: enc}
+		return callMarshaler(t, "MarshalLogArray", func() error { return elems.array(m) })
+
+	case json.Marshaler:
+		var b []byte
+		err := callMarshaler(t, "MarshalJSON", func() (err error) {
+			b, err = m.MarshalJSON()
+			return err
+		})
+		if err != nil {
+			return err
 		}
+		return enc.writeRawJSON(t, b)
 
-		if fieldCount > 0 {
-			enc.buf.WriteByte(',')
+	case encoding.TextMarshaler:
+		var b []byte
+		err := callMarshaler(t, "MarshalText", func() (err error) {
+			b, err = m.MarshalText()
+			return err
+		})
+		if err != nil {
+			return err
 		}
+		enc.writeQuotedString(string(b))
 
-		// Use json tag if available, otherwise use field name
-		fieldName := field.Name
-		if tag := field.Tag.Get("json"); tag != "" && tag != "-" {
-			if commaIdx := strings.Index(tag, ","); commaIdx != -1 {
-				fieldName = tag[:commaIdx]
-			} else {
-				fieldName = tag
-			}
+	case error:
+		var s string
+		if err := callMarshaler(t, "Error", func() error { s = m.Error(); return nil }); err != nil {
+			return err
 		}
+		enc.writeQuotedString(s)
 
-		// Always quote field names in JSON format
-		enc.buf.WriteByte('"')
-		enc.buf.WriteString(fieldName)
-		enc.buf.WriteByte('"')
-		enc.buf.WriteByte(':')
-
-		if err := enc.encodeValue(fieldValue); err != nil {
+	case fmt.Stringer:
+		var s string
+		if err := callMarshaler(t, "String", func() error { s = m.String(); return nil }); err != nil {
 			return err
 		}
+		enc.writeQuotedString(s)
+	}
+	return nil
+}
 
-		fieldCount++
+// callMarshaler calls the marshaling method of a value of type t wrapped in
+// call, turning an error returned by the method, or a panic in it, into an
+// error naming the method and the type.
+func callMarshaler(t reflect.Type, method string, call func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic calling %s for type %v: %v", method, t, r)
+		}
+	}()
+	if err := call(); err != nil {
+		return fmt.Errorf("error calling %s for type %v: %w", method, t, err)
 	}
+	return nil
+}
 
-	enc.buf.WriteByte('}')
+// writeRawJSON writes the output of MarshalJSON compacted, after checking that
+// it's valid JSON.
+func (enc *ReflectEncoder) writeRawJSON(t reflect.Type, b []byte) error {
+	compacted := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		compacted.Reset()
+		bufferPool.Put(compacted)
+	}()
+	compacted.Reset()
+	if err := json.Compact(compacted, b); err != nil {
+		return fmt.Errorf("error calling MarshalJSON for type %v: %w", t, err)
+	}
+	if enc.escapeHTML {
+		json.HTMLEscape(enc.buf, compacted.Bytes())
+	} else {
+		enc.buf.Write(compacted.Bytes())
+	}
 	return nil
 }
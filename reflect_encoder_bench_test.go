@@ -2,6 +2,9 @@ package zaptext_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
 	"testing"
 	"time"
 
@@ -33,6 +36,7 @@ func BenchmarkReflectEncoderEncode(b *testing.B) {
 		},
 	}
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		w := bytes.NewBuffer(make([]byte, 0, 1024))
@@ -57,6 +61,7 @@ func BenchmarkReflectEncoderEncodeMap(b *testing.B) {
 		},
 	}
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		w := bytes.NewBuffer(make([]byte, 0, 512))
@@ -78,6 +83,7 @@ func BenchmarkReflectEncoderEncodeSlice(b *testing.B) {
 		map[string]string{"key": "value"},
 	}
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		w := bytes.NewBuffer(make([]byte, 0, 256))
@@ -88,3 +94,112 @@ func BenchmarkReflectEncoderEncodeSlice(b *testing.B) {
 		encoder.Release()
 	}
 }
+
+type benchAddress struct {
+	Street string `json:"street"`
+	City   string `json:"city"`
+	Zip    string `json:"zip,omitempty"`
+}
+
+type benchAudit struct {
+	CreatedBy string    `json:"created_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type benchOrder struct {
+	benchAudit
+	ID       int64             `json:"id,string"`
+	Customer *benchAddress     `json:"customer"`
+	Items    []benchItem       `json:"items"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Client   net.IP            `json:"client"`
+	Err      error             `json:"err,omitempty"`
+	Note     *string           `json:"note"`
+}
+
+type benchItem struct {
+	SKU      string  `json:"sku"`
+	Quantity int     `json:"quantity"`
+	Price    float64 `json:"price"`
+}
+
+func newBenchOrder() benchOrder {
+	return benchOrder{
+		benchAudit: benchAudit{CreatedBy: "checkout", UpdatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		ID:         12345,
+		Customer:   &benchAddress{Street: "1 Main St", City: "Springfield"},
+		Items: []benchItem{
+			{SKU: "A-1", Quantity: 2, Price: 9.99},
+			{SKU: "B-2", Quantity: 1, Price: 24.5},
+			{SKU: "C-3", Quantity: 5, Price: 1.25},
+		},
+		Labels: map[string]string{"channel": "web", "region": "eu", "tier": "gold"},
+		Client: net.IPv4(10, 0, 0, 1),
+		Err:    errors.New("card declined"),
+	}
+}
+
+func BenchmarkReflectEncoderEncodeNested(b *testing.B) {
+	order := newBenchOrder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := bytes.NewBuffer(make([]byte, 0, 1024))
+		encoder := NewReflectEncoder(w)
+		if err := encoder.Encode(order); err != nil {
+			b.Fatal(err)
+		}
+		encoder.Release()
+	}
+}
+
+func BenchmarkReflectEncoderEncodeIntMap(b *testing.B) {
+	testMap := make(map[int]int, 32)
+	for i := 0; i < 32; i++ {
+		testMap[i*7] = i
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := bytes.NewBuffer(make([]byte, 0, 512))
+		encoder := NewReflectEncoder(w)
+		if err := encoder.Encode(testMap); err != nil {
+			b.Fatal(err)
+		}
+		encoder.Release()
+	}
+}
+
+func BenchmarkReflectEncoderEncodeParallel(b *testing.B) {
+	order := newBenchOrder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		w := bytes.NewBuffer(make([]byte, 0, 1024))
+		for pb.Next() {
+			w.Reset()
+			encoder := NewReflectEncoder(w)
+			if err := encoder.Encode(order); err != nil {
+				b.Fatal(err)
+			}
+			encoder.Release()
+		}
+	})
+}
+
+// BenchmarkJSONMarshalNested is a reference point for
+// BenchmarkReflectEncoderEncodeNested.
+func BenchmarkJSONMarshalNested(b *testing.B) {
+	order := newBenchOrder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(order); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
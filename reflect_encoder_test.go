@@ -2,12 +2,20 @@ package zaptext_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"net"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	. "github.com/kaiiak/zaptext"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestNewReflectEncoder(t *testing.T) {
@@ -556,3 +564,538 @@ func TestReflectEncoderStringEscaping(t *testing.T) {
 		}
 	})
 }
+
+func TestReflectEncoderJSONTags(t *testing.T) {
+	type Address struct {
+		City string `json:"city"`
+		Zip  string `json:"zip,omitempty"`
+	}
+	type Tagged struct {
+		ID       int               `json:"id,string"`
+		Active   bool              `json:"active,string"`
+		Label    string            `json:"label,string"`
+		Secret   string            `json:"-"`
+		Dash     string            `json:"-,"`
+		Note     string            `json:",omitempty"`
+		Count    int               `json:"count,omitempty"`
+		Tags     []string          `json:"tags,omitempty"`
+		Extra    map[string]string `json:"extra,omitempty"`
+		Ratio    float64           `json:"ratio,omitempty"`
+		Any      any               `json:"any,omitempty"`
+		Items    []int             `json:"items,string"`
+		Address  Address           `json:"address,omitempty"`
+		Untagged string
+	}
+
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{"Zero values", Tagged{}},
+		{"Set values", Tagged{
+			ID: 7, Active: true, Label: `say "hi"`, Secret: "hidden", Dash: "dash", Note: "note",
+			Count: 3, Tags: []string{"a"}, Extra: map[string]string{"k": "v"}, Ratio: 0.5, Any: 1,
+			Items: []int{1}, Address: Address{City: "Paris", Zip: "75001"}, Untagged: "u",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// ReflectEncoder follows the tag rules of encoding/json, so that
+			// the logged shape matches the wire format.
+			expected, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("json.Marshal failed: %v", err)
+			}
+
+			w := &bytes.Buffer{}
+			encoder := NewReflectEncoder(w)
+			defer encoder.Release()
+			if err := encoder.Encode(tt.value); err != nil {
+				t.Fatalf("Encode returned error: %v", err)
+			}
+			if w.String() != string(expected) {
+				t.Errorf("Expected %s, got: %s", expected, w.String())
+			}
+		})
+	}
+
+	t.Run("Invalid names", func(t *testing.T) {
+		type Invalid struct {
+			Quote string `json:"a\"b"`
+			Slash string `json:"a\\b,omitempty"`
+		}
+
+		w := &bytes.Buffer{}
+		encoder := NewReflectEncoder(w)
+		defer encoder.Release()
+		if err := encoder.Encode(Invalid{Quote: "q", Slash: "s"}); err != nil {
+			t.Fatalf("Encode returned error: %v", err)
+		}
+		expected := `{"Quote":"q","Slash":"s"}`
+		if w.String() != expected {
+			t.Errorf("Expected %s, got: %s", expected, w.String())
+		}
+	})
+
+	t.Run("Inline", func(t *testing.T) {
+		type Meta struct {
+			Version int    `json:"version"`
+			Owner   string `json:"owner,omitempty"`
+		}
+		type Ref struct {
+			Kind string `json:"kind"`
+		}
+		type Resource struct {
+			Name string `json:"name"`
+			Meta Meta   `json:",inline"`
+			Ref  *Ref   `json:"ref,inline"`
+		}
+
+		w := &bytes.Buffer{}
+		encoder := NewReflectEncoder(w)
+		defer encoder.Release()
+		if err := encoder.Encode(Resource{Name: "db", Meta: Meta{Version: 2}, Ref: &Ref{Kind: "svc"}}); err != nil {
+			t.Fatalf("Encode returned error: %v", err)
+		}
+		expected := `{"name":"db","version":2,"kind":"svc"}`
+		if w.String() != expected {
+			t.Errorf("Expected %s, got: %s", expected, w.String())
+		}
+	})
+}
+
+type embeddedBase struct {
+	ID   int    `json:"id"`
+	Kind string `json:"kind,omitempty"`
+}
+
+type embeddedAudit struct {
+	Created string `json:"created"`
+	Note    string
+}
+
+type embeddedNote struct {
+	Note string
+}
+
+type embeddedCount int
+
+type embeddedInner struct {
+	Depth int `json:"depth"`
+	embeddedBase
+}
+
+func TestReflectEncoderEmbedded(t *testing.T) {
+	type Plain struct {
+		embeddedBase
+		Name string `json:"name"`
+	}
+	type Pointer struct {
+		*embeddedBase
+		Name string `json:"name"`
+	}
+	type Named struct {
+		embeddedBase `json:"base"`
+		Name         string `json:"name"`
+	}
+	type Shadowed struct {
+		embeddedBase
+		ID string `json:"id"`
+	}
+	type Conflict struct {
+		embeddedNote
+		embeddedAudit
+	}
+	type TaggedWins struct {
+		embeddedNote
+		Other struct {
+			Note string `json:"Note"`
+		} `json:",inline"`
+	}
+	type NonStruct struct {
+		embeddedCount
+		Count embeddedCount `json:"count"`
+	}
+	type Deep struct {
+		embeddedInner
+		Name string `json:"name"`
+	}
+	type Twice struct {
+		embeddedInner
+		*embeddedBase
+	}
+
+	tests := []struct {
+		name     string
+		value    any
+		expected string
+	}{
+		{"Promoted fields", Plain{embeddedBase{ID: 1}, "bob"}, `{"id":1,"name":"bob"}`},
+		{"Embedded pointer", Pointer{&embeddedBase{ID: 1, Kind: "user"}, "bob"}, `{"id":1,"kind":"user","name":"bob"}`},
+		{"Nil embedded pointer", Pointer{nil, "bob"}, `{"name":"bob"}`},
+		{"Tag-named embed", Named{embeddedBase{ID: 1}, "bob"}, `{"base":{"id":1},"name":"bob"}`},
+		{"Shallower field dominates", Shadowed{embeddedBase{ID: 1}, "x1"}, `{"id":"x1"}`},
+		{"Conflicting fields are dropped", Conflict{embeddedNote{"a"}, embeddedAudit{"today", "b"}}, `{"created":"today"}`},
+		{"Tagged field dominates", TaggedWins{embeddedNote: embeddedNote{Note: "untagged"}}, `{"Note":""}`},
+		{"Embedded non-struct", NonStruct{1, 2}, `{"count":2}`},
+		{"Nested embedding", Deep{embeddedInner{Depth: 2, embeddedBase: embeddedBase{ID: 1}}, "bob"}, `{"depth":2,"id":1,"name":"bob"}`},
+		{"Same type at the same depth", Twice{embeddedInner{Depth: 2}, &embeddedBase{ID: 1}}, `{"depth":2,"id":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			encoder := NewReflectEncoder(w)
+			defer encoder.Release()
+			if err := encoder.Encode(tt.value); err != nil {
+				t.Fatalf("Encode returned error: %v", err)
+			}
+			if w.String() != tt.expected {
+				t.Errorf("Expected %s, got: %s", tt.expected, w.String())
+			}
+		})
+	}
+}
+
+type marshalUser struct {
+	Name string
+	Age  int
+}
+
+func (u marshalUser) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", u.Name)
+	enc.AddInt("age", u.Age)
+	return nil
+}
+
+type marshalTags []string
+
+func (tags marshalTags) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, tag := range tags {
+		enc.AppendString(tag)
+	}
+	return nil
+}
+
+type marshalRaw string
+
+func (r marshalRaw) MarshalJSON() ([]byte, error) {
+	if r == "fail" {
+		return nil, errors.New("refused")
+	}
+	return []byte(r), nil
+}
+
+type marshalLevel int
+
+func (l marshalLevel) String() string {
+	switch l {
+	case 0:
+		return "info"
+	case 1:
+		return "warn"
+	}
+	panic("unknown level")
+}
+
+type marshalBoth struct{}
+
+func (marshalBoth) MarshalText() ([]byte, error) { return []byte("text"), nil }
+func (marshalBoth) String() string               { return "string" }
+
+type marshalPointer struct {
+	ID int `json:"id"`
+}
+
+func (p *marshalPointer) String() string { return fmt.Sprintf("#%d", p.ID) }
+
+func TestReflectEncoderMarshalers(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		expected string
+	}{
+		{"ObjectMarshaler", marshalUser{"bob", 30}, `{"name":"bob","age":30}`},
+		{"ArrayMarshaler", marshalTags{"a", "b"}, `["a","b"]`},
+		{"json.Marshaler", marshalRaw(`{ "x" : [1, 2], "html": "<b>" }`), `{"x":[1,2],"html":"\u003cb\u003e"}`},
+		{"json.Marshaler of the standard library", big.NewInt(12345678901234567), `12345678901234567`},
+		{"TextMarshaler", net.ParseIP("10.0.0.1"), `"10.0.0.1"`},
+		{"error", errors.New(`bad "input"`), `"bad \"input\""`},
+		{"Stringer", marshalLevel(1), `"warn"`},
+		{"TextMarshaler before Stringer", marshalBoth{}, `"text"`},
+		{"Pointer receiver", &marshalPointer{ID: 7}, `"#7"`},
+		{"Pointer receiver of an unaddressable value", marshalPointer{ID: 7}, `{"id":7}`},
+		{
+			"Nested",
+			struct {
+				User  marshalUser            `json:"user"`
+				IP    net.IP                 `json:"ip"`
+				Err   error                  `json:"err"`
+				Level marshalLevel           `json:"level"`
+				Ptr   marshalPointer         `json:"ptr"`
+				Map   map[string]marshalTags `json:"map"`
+			}{marshalUser{"bob", 30}, net.IPv4(10, 0, 0, 1), errors.New("boom"), 0, marshalPointer{ID: 1}, map[string]marshalTags{"k": {"v"}}},
+			`{"user":{"name":"bob","age":30},"ip":"10.0.0.1","err":"boom","level":"info","ptr":{"id":1},"map":{"k":["v"]}}`,
+		},
+		{
+			"String option is ignored for marshalers",
+			struct {
+				Level    marshalLevel   `json:"level,string"`
+				Elapsed  time.Duration  `json:"elapsed,string"`
+				Timeout  *time.Duration `json:"timeout,string"`
+				Attempts int            `json:"attempts,string"`
+			}{1, time.Second, new(time.Duration), 3},
+			`{"level":"warn","elapsed":"1s","timeout":"0s","attempts":"3"}`,
+		},
+		{"Time keeps its format", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), `"2024-01-02T03:04:05Z"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			encoder := NewReflectEncoder(w)
+			defer encoder.Release()
+			if err := encoder.Encode(tt.value); err != nil {
+				t.Fatalf("Encode returned error: %v", err)
+			}
+			if w.String() != tt.expected {
+				t.Errorf("Expected %s, got: %s", tt.expected, w.String())
+			}
+		})
+	}
+}
+
+func TestReflectEncoderMatchesZapJSON(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	obj := zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		enc.AddString("z", "first")
+		enc.AddBinary("bin", []byte("hi"))
+		enc.AddByteString("bytes", []byte("text"))
+		enc.AddBool("ok", true)
+		enc.AddComplex128("c", complex(1, -2))
+		enc.AddFloat64("f", 1e21)
+		enc.AddFloat32("nan", float32(math.NaN()))
+		enc.AddInt8("i", -8)
+		enc.AddUintptr("p", 16)
+		enc.AddTime("at", at)
+		enc.AddDuration("d", time.Second)
+		if err := enc.AddReflected("r", map[string]int{"n": 1}); err != nil {
+			return err
+		}
+		if err := enc.AddArray("arr", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			arr.AppendString("a")
+			arr.AppendInt(1)
+			arr.AppendComplex64(complex(0, 1))
+			return arr.AppendObject(marshalUser{"ann", 7})
+		})); err != nil {
+			return err
+		}
+		enc.OpenNamespace("ns")
+		enc.AddString("inner", "x")
+		return enc.AddObject("user", marshalUser{"bob", 30})
+	})
+
+	cfg := zapcore.EncoderConfig{EncodeTime: zapcore.RFC3339TimeEncoder, EncodeDuration: zapcore.StringDurationEncoder}
+	buf, err := zapcore.NewJSONEncoder(cfg).EncodeEntry(zapcore.Entry{}, []zapcore.Field{zap.Object("o", obj)})
+	if err != nil {
+		t.Fatalf("EncodeEntry failed: %v", err)
+	}
+	expected := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(buf.String()), `{"o":`), "}")
+
+	w := &bytes.Buffer{}
+	encoder := NewReflectEncoder(w)
+	defer encoder.Release()
+	if err := encoder.Encode(obj); err != nil {
+		t.Fatalf("Encode returned error: %v", err)
+	}
+	if w.String() != expected {
+		t.Errorf("Expected %s, got: %s", expected, w.String())
+	}
+}
+
+func TestReflectEncoderMarshalerErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		expected string
+	}{
+		{"Returned error", marshalRaw("fail"), "error calling MarshalJSON for type zaptext_test.marshalRaw: refused"},
+		{"Invalid JSON", marshalRaw("{"), "error calling MarshalJSON for type zaptext_test.marshalRaw: unexpected end of JSON input"},
+		{"Panic", []marshalLevel{0, 2}, "panic calling String for type zaptext_test.marshalLevel: unknown level"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			encoder := NewReflectEncoder(w)
+			defer encoder.Release()
+			err := encoder.Encode(tt.value)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("Expected error %q, got: %v", tt.expected, err)
+			}
+			if w.Len() != 0 {
+				t.Errorf("Expected no output, got: %s", w.String())
+			}
+		})
+	}
+}
+
+type planTree struct {
+	Name     string      `json:"name"`
+	Children []*planTree `json:"children,omitempty"`
+}
+
+func TestReflectEncoderPlans(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      any
+		escapeHTML bool
+		expected   string
+	}{
+		{"Array", [3]int{1, 2, 3}, true, `[1,2,3]`},
+		{"Recursive type", &planTree{Name: "root", Children: []*planTree{{Name: "leaf"}}}, true, `{"name":"root","children":[{"name":"leaf"}]}`},
+		{"Integer map keys", map[int]string{10: "b", 9: "a"}, true, `{"10":"b","9":"a"}`},
+		{"Stringer map keys", map[marshalLevel]int{1: 2, 0: 1}, true, `{"info":1,"warn":2}`},
+		{"Escaped map keys", map[string]int{"x\ny": 1, `a"b`: 2, "<c>": 3}, true, `{"\u003cc\u003e":3,"a\"b":2,"x\ny":1}`},
+		{"Escaped field names", struct {
+			A int `json:"<a>"`
+		}{1}, true, `{"\u003ca\u003e":1}`},
+		{"Field names without HTML escaping", struct {
+			A int `json:"<a>"`
+		}{1}, false, `{"<a>":1}`},
+		{"Control characters and invalid UTF-8", "a\x01\xffb\u00e9", true, `"a\u0001` + "\ufffdb\u00e9\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			encoder := NewReflectEncoder(w)
+			defer encoder.Release()
+			encoder.SetEscapeHTML(tt.escapeHTML)
+			if err := encoder.Encode(tt.value); err != nil {
+				t.Fatalf("Encode returned error: %v", err)
+			}
+			if w.String() != tt.expected {
+				t.Errorf("Expected %s, got: %s", tt.expected, w.String())
+			}
+		})
+	}
+}
+
+func TestReflectEncoderConcurrentPlans(t *testing.T) {
+	type item struct {
+		ID   int               `json:"id"`
+		Tags map[string]string `json:"tags"`
+	}
+	type batch struct {
+		Items []item   `json:"items"`
+		Next  *batch   `json:"next"`
+		Err   error    `json:"err"`
+		Names []string `json:"names,omitempty"`
+	}
+	value := batch{
+		Items: []item{{1, map[string]string{"a": "b"}}},
+		Next:  &batch{Names: []string{"x"}},
+		Err:   errors.New("boom"),
+	}
+	expected := `{"items":[{"id":1,"tags":{"a":"b"}}],"next":{"items":null,"err":null,"names":["x"]},"err":"boom"}`
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				w := &bytes.Buffer{}
+				encoder := NewReflectEncoder(w)
+				err := encoder.Encode(value)
+				encoder.Release()
+				if err != nil {
+					t.Errorf("Encode returned error: %v", err)
+					return
+				}
+				if w.String() != expected {
+					t.Errorf("Expected %s, got: %s", expected, w.String())
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+type cycleNode struct {
+	Name     string       `json:"name"`
+	Parent   *cycleNode   `json:"parent"`
+	Children []*cycleNode `json:"children,omitempty"`
+}
+
+type cycleWrapper struct {
+	First cycleFirst
+}
+
+type cycleFirst struct {
+	Self *cycleFirst
+}
+
+func TestReflectEncoderCycles(t *testing.T) {
+	root := &cycleNode{Name: "root"}
+	root.Children = []*cycleNode{{Name: "child", Parent: root}}
+
+	selfMap := map[string]any{"name": "m"}
+	selfMap["self"] = selfMap
+
+	selfSlice := []any{1, nil}
+	selfSlice[1] = selfSlice
+
+	shared := &cycleNode{Name: "shared"}
+
+	wrapper := &cycleWrapper{}
+	wrapper.First.Self = &wrapper.First
+
+	tests := []struct {
+		name     string
+		value    any
+		expected string
+	}{
+		{"Parent pointer", root, `{"name":"root","children":[{"name":"child","parent":"<cycle>"}]}`},
+		{"Self-referencing map", selfMap, `{"name":"m","self":"<cycle>"}`},
+		{"Self-referencing slice", selfSlice, `[1,"<cycle>"]`},
+		{"Shared pointers are not cycles", []*cycleNode{shared, shared}, `[{"name":"shared"},{"name":"shared"}]`},
+		{"Type is part of the identity", wrapper, `{"First":{"Self":{"Self":"<cycle>"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			encoder := NewReflectEncoder(w)
+			defer encoder.Release()
+			if err := encoder.Encode(tt.value); err != nil {
+				t.Fatalf("Encode returned error: %v", err)
+			}
+			if w.String() != tt.expected {
+				t.Errorf("Expected %s, got: %s", tt.expected, w.String())
+			}
+		})
+	}
+
+	t.Run("Fail on cycle", func(t *testing.T) {
+		w := &bytes.Buffer{}
+		encoder := NewReflectEncoder(w)
+		encoder.SetFailOnCycle(true)
+		err := encoder.Encode(root)
+		encoder.Release()
+		expected := "encountered a cycle via *zaptext_test.cycleNode"
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q, got: %v", expected, err)
+		}
+		if w.Len() != 0 {
+			t.Errorf("Expected no output, got: %s", w.String())
+		}
+
+		// The path left by the failed encoding doesn't leak into the next one.
+		encoder = NewReflectEncoder(w)
+		defer encoder.Release()
+		if err := encoder.Encode(root.Children[0]); err != nil {
+			t.Fatalf("Encode returned error: %v", err)
+		}
+		if expected := `{"name":"child","parent":{"name":"root","children":["<cycle>"]}}`; w.String() != expected {
+			t.Errorf("Expected %s, got: %s", expected, w.String())
+		}
+	})
+}
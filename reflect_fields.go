@@ -0,0 +1,255 @@
+package zaptext
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// structField is a field encoded by ReflectEncoder, possibly promoted from an
+// embedded struct.
+type structField struct {
+	name      string
+	index     []int        // the path to the field through embedded structs
+	typ       reflect.Type // the type of the field, or of an embedded struct to explore
+	tagged    bool         // whether the name comes from a json tag
+	omitEmpty bool
+	quoted    bool
+}
+
+// typeFields returns the fields of the struct type t in the order they are
+// encoded. Like encoding/json, the fields of embedded structs, and of struct
+// fields tagged inline, are promoted into t unless the embedded field has a
+// tag name. When several fields end up with the same name, the shallowest one
+// wins, a tagged one winning among the shallowest; if that leaves a tie, none
+// of them is encoded.
+func typeFields(t reflect.Type) []structField {
+	// The structs are walked breadth first, one embedding depth at a time, so
+	// that the candidates for a name are found shallowest first. A struct
+	// type reached several times at the same depth is walked once, and its
+	// fields are then ambiguous; a struct type already walked at a lower
+	// depth has all its fields hidden and isn't walked again.
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+		times int
+	}
+	type candidate struct {
+		structField
+		ambiguous bool
+	}
+
+	var candidates []candidate
+	walked := map[reflect.Type]bool{}
+	for depth := []embedded{{typ: t, times: 1}}; len(depth) > 0; {
+		var deeper []embedded
+		queued := map[reflect.Type]int{}
+		for _, s := range depth {
+			if walked[s.typ] {
+				continue
+			}
+			walked[s.typ] = true
+
+			for i := 0; i < s.typ.NumField(); i++ {
+				sf := s.typ.Field(i)
+				if !sf.IsExported() && !(sf.Anonymous && isStructOrPointer(sf.Type)) {
+					// An unexported embedded struct may still promote
+					// exported fields; anything else unexported is skipped.
+					continue
+				}
+				tag, ok := parseJSONTag(sf)
+				if !ok {
+					continue
+				}
+				index := append(s.index[:len(s.index):len(s.index)], i)
+
+				ft := sf.Type
+				if ft.Kind() == reflect.Ptr && ft.Name() == "" {
+					ft = ft.Elem()
+				}
+				promote := (sf.Anonymous && tag.name == "") || tag.inline
+				if promote && ft.Kind() == reflect.Struct && ft != timeType {
+					if j, ok := queued[ft]; ok {
+						deeper[j].times++
+					} else {
+						queued[ft] = len(deeper)
+						deeper = append(deeper, embedded{typ: ft, index: index, times: 1})
+					}
+					continue
+				}
+
+				name := tag.name
+				if name == "" {
+					name = sf.Name
+				}
+				candidates = append(candidates, candidate{
+					structField: structField{
+						name:      name,
+						index:     index,
+						typ:       sf.Type,
+						tagged:    tag.name != "",
+						omitEmpty: tag.omitEmpty,
+						quoted:    tag.quoted,
+					},
+					ambiguous: s.times > 1,
+				})
+			}
+		}
+		depth = deeper
+	}
+
+	// Keep the shallowest candidates for each name, then pick the winner
+	// among them: the only tagged one, or else the only one.
+	byName := map[string][]candidate{}
+	for _, c := range candidates {
+		shallowest := byName[c.name]
+		if len(shallowest) > 0 && len(shallowest[0].index) < len(c.index) {
+			continue
+		}
+		byName[c.name] = append(shallowest, c)
+	}
+	var fields []structField
+	for _, group := range byName {
+		var tagged []candidate
+		for _, c := range group {
+			if c.tagged {
+				tagged = append(tagged, c)
+			}
+		}
+		if len(tagged) > 0 {
+			group = tagged
+		}
+		if len(group) == 1 && !group[0].ambiguous {
+			fields = append(fields, group[0].structField)
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		return indexLess(fields[i].index, fields[j].index)
+	})
+	return fields
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// isStructOrPointer reports whether t is a struct or a pointer to one.
+func isStructOrPointer(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// indexLess orders field indexes in declaration order, depth first.
+func indexLess(x, y []int) bool {
+	for k := 0; k < len(x) && k < len(y); k++ {
+		if x[k] != y[k] {
+			return x[k] < y[k]
+		}
+	}
+	return len(x) < len(y)
+}
+
+// fieldByIndex returns the field of the struct v at index, following
+// embedded pointers. It reports false when one of them is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// jsonTag holds the settings of a struct field given by its json tag.
+type jsonTag struct {
+	name      string
+	omitEmpty bool
+	quoted    bool
+	inline    bool
+}
+
+// parseJSONTag parses the json tag of field, following the rules of
+// encoding/json: it returns false for fields tagged "-", an invalid name is
+// ignored, omitempty skips empty values and string quotes booleans, numbers
+// and strings. In addition, inline promotes the fields of a struct field
+// into the enclosing object as if it were embedded.
+func parseJSONTag(field reflect.StructField) (jsonTag, bool) {
+	raw := field.Tag.Get("json")
+	if raw == "-" {
+		return jsonTag{}, false
+	}
+	name, opts, _ := strings.Cut(raw, ",")
+	var tag jsonTag
+	if isValidTagName(name) {
+		tag.name = name
+	}
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		switch opt {
+		case "omitempty":
+			tag.omitEmpty = true
+		case "string":
+			tag.quoted = isQuotableType(field.Type)
+		case "inline":
+			tag.inline = true
+		}
+	}
+	return tag, true
+}
+
+// isValidTagName reports whether name is usable as a key, with the rules of
+// encoding/json.
+func isValidTagName(name string) bool {
+	if name == "" {
+		return false
+	}
+	// Letters, digits, spaces and punctuation other than the quote and
+	// backslash, which the tag syntax reserves, are accepted.
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isQuotableType reports whether the string option applies to t: booleans,
+// numbers and strings, or pointers to them.
+func isQuotableType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr && t.Name() == "" {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.String:
+		return true
+	}
+	return false
+}
+
+// isEmptyValue reports whether v is empty in the sense of omitempty: false,
+// zero, nil, or of length zero. Structs are never empty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Ptr:
+		return v.IsZero()
+	}
+	return false
+}
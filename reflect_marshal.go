@@ -0,0 +1,286 @@
+package zaptext
+
+import (
+	"encoding/base64"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	_ zapcore.ObjectEncoder = (*marshalerEncoder)(nil)
+	_ zapcore.ArrayEncoder  = (*marshalerEncoder)(nil)
+)
+
+// marshalerEncoder is the zapcore.ObjectEncoder and zapcore.ArrayEncoder that
+// ReflectEncoder hands to MarshalLogObject and MarshalLogArray. Like zap's
+// JSON encoder, it writes fields in the order they're added, binary data as
+// base64, complex numbers as strings such as "1+2i" and non-finite floats as
+// "NaN", "+Inf" or "-Inf". Times and durations, for which zap defers to the
+// EncoderConfig, are written as ReflectEncoder writes them elsewhere: times in
+// RFC3339 and durations with their String method.
+type marshalerEncoder struct {
+	enc *ReflectEncoder
+
+	// count is the number of fields or elements written in the current
+	// object or array, openNamespaces the number of namespaces opened in the
+	// current object.
+	count          int
+	openNamespaces int
+}
+
+// object writes the object produced by obj.
+func (m *marshalerEncoder) object(obj zapcore.ObjectMarshaler) error {
+	if err := m.enc.checkDepth(); err != nil {
+		return err
+	}
+	count, openNamespaces := m.count, m.openNamespaces
+	m.count, m.openNamespaces = 0, 0
+	m.enc.buf.WriteByte('{')
+	m.enc.depth++
+	err := obj.MarshalLogObject(m)
+	m.enc.depth--
+	for ; m.openNamespaces > 0; m.openNamespaces-- {
+		m.enc.buf.WriteByte('}')
+	}
+	m.enc.buf.WriteByte('}')
+	m.count, m.openNamespaces = count, openNamespaces
+	return err
+}
+
+// array writes the array produced by arr.
+func (m *marshalerEncoder) array(arr zapcore.ArrayMarshaler) error {
+	if err := m.enc.checkDepth(); err != nil {
+		return err
+	}
+	count := m.count
+	m.count = 0
+	m.enc.buf.WriteByte('[')
+	m.enc.depth++
+	err := arr.MarshalLogArray(m)
+	m.enc.depth--
+	m.enc.buf.WriteByte(']')
+	m.count = count
+	return err
+}
+
+func (m *marshalerEncoder) addKey(key string) {
+	m.addElementSeparator()
+	m.enc.writeQuotedString(key)
+	m.enc.buf.WriteByte(':')
+}
+
+func (m *marshalerEncoder) addElementSeparator() {
+	if m.count > 0 {
+		m.enc.buf.WriteByte(',')
+	}
+	m.count++
+}
+
+func (m *marshalerEncoder) OpenNamespace(key string) {
+	m.addKey(key)
+	m.enc.buf.WriteByte('{')
+	m.count = 0
+	m.openNamespaces++
+}
+
+func (m *marshalerEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	m.addKey(key)
+	return m.array(arr)
+}
+
+func (m *marshalerEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	m.addKey(key)
+	return m.object(obj)
+}
+
+func (m *marshalerEncoder) AddReflected(key string, value any) error {
+	m.addKey(key)
+	return m.enc.encodeValue(reflect.ValueOf(value))
+}
+
+func (m *marshalerEncoder) AddBinary(key string, value []byte) {
+	m.AddString(key, base64.StdEncoding.EncodeToString(value))
+}
+
+func (m *marshalerEncoder) AddByteString(key string, value []byte) {
+	m.AddString(key, string(value))
+}
+
+func (m *marshalerEncoder) AddBool(key string, value bool) {
+	m.addKey(key)
+	m.writeBool(value)
+}
+
+func (m *marshalerEncoder) AddComplex128(key string, value complex128) {
+	m.addKey(key)
+	m.writeComplex(value, 64)
+}
+
+func (m *marshalerEncoder) AddComplex64(key string, value complex64) {
+	m.addKey(key)
+	m.writeComplex(complex128(value), 32)
+}
+
+func (m *marshalerEncoder) AddDuration(key string, value time.Duration) {
+	m.AddString(key, value.String())
+}
+
+func (m *marshalerEncoder) AddFloat64(key string, value float64) {
+	m.addKey(key)
+	m.writeFloat(value, 64)
+}
+
+func (m *marshalerEncoder) AddFloat32(key string, value float32) {
+	m.addKey(key)
+	m.writeFloat(float64(value), 32)
+}
+
+func (m *marshalerEncoder) AddInt(key string, value int)     { m.AddInt64(key, int64(value)) }
+func (m *marshalerEncoder) AddInt32(key string, value int32) { m.AddInt64(key, int64(value)) }
+func (m *marshalerEncoder) AddInt16(key string, value int16) { m.AddInt64(key, int64(value)) }
+func (m *marshalerEncoder) AddInt8(key string, value int8)   { m.AddInt64(key, int64(value)) }
+
+func (m *marshalerEncoder) AddInt64(key string, value int64) {
+	m.addKey(key)
+	m.enc.buf.Write(strconv.AppendInt(m.enc.scratch[:0], value, 10))
+}
+
+func (m *marshalerEncoder) AddString(key, value string) {
+	m.addKey(key)
+	m.enc.writeQuotedString(value)
+}
+
+func (m *marshalerEncoder) AddTime(key string, value time.Time) {
+	m.addKey(key)
+	m.writeTime(value)
+}
+
+func (m *marshalerEncoder) AddUint(key string, value uint)       { m.AddUint64(key, uint64(value)) }
+func (m *marshalerEncoder) AddUint32(key string, value uint32)   { m.AddUint64(key, uint64(value)) }
+func (m *marshalerEncoder) AddUint16(key string, value uint16)   { m.AddUint64(key, uint64(value)) }
+func (m *marshalerEncoder) AddUint8(key string, value uint8)     { m.AddUint64(key, uint64(value)) }
+func (m *marshalerEncoder) AddUintptr(key string, value uintptr) { m.AddUint64(key, uint64(value)) }
+
+func (m *marshalerEncoder) AddUint64(key string, value uint64) {
+	m.addKey(key)
+	m.enc.buf.Write(strconv.AppendUint(m.enc.scratch[:0], value, 10))
+}
+
+func (m *marshalerEncoder) AppendArray(arr zapcore.ArrayMarshaler) error {
+	m.addElementSeparator()
+	return m.array(arr)
+}
+
+func (m *marshalerEncoder) AppendObject(obj zapcore.ObjectMarshaler) error {
+	m.addElementSeparator()
+	return m.object(obj)
+}
+
+func (m *marshalerEncoder) AppendReflected(value any) error {
+	m.addElementSeparator()
+	return m.enc.encodeValue(reflect.ValueOf(value))
+}
+
+func (m *marshalerEncoder) AppendBool(value bool) {
+	m.addElementSeparator()
+	m.writeBool(value)
+}
+
+func (m *marshalerEncoder) AppendByteString(value []byte) {
+	m.AppendString(string(value))
+}
+
+func (m *marshalerEncoder) AppendComplex128(value complex128) {
+	m.addElementSeparator()
+	m.writeComplex(value, 64)
+}
+
+func (m *marshalerEncoder) AppendComplex64(value complex64) {
+	m.addElementSeparator()
+	m.writeComplex(complex128(value), 32)
+}
+
+func (m *marshalerEncoder) AppendDuration(value time.Duration) {
+	m.AppendString(value.String())
+}
+
+func (m *marshalerEncoder) AppendFloat64(value float64) {
+	m.addElementSeparator()
+	m.writeFloat(value, 64)
+}
+
+func (m *marshalerEncoder) AppendFloat32(value float32) {
+	m.addElementSeparator()
+	m.writeFloat(float64(value), 32)
+}
+
+func (m *marshalerEncoder) AppendInt(value int)     { m.AppendInt64(int64(value)) }
+func (m *marshalerEncoder) AppendInt32(value int32) { m.AppendInt64(int64(value)) }
+func (m *marshalerEncoder) AppendInt16(value int16) { m.AppendInt64(int64(value)) }
+func (m *marshalerEncoder) AppendInt8(value int8)   { m.AppendInt64(int64(value)) }
+
+func (m *marshalerEncoder) AppendInt64(value int64) {
+	m.addElementSeparator()
+	m.enc.buf.Write(strconv.AppendInt(m.enc.scratch[:0], value, 10))
+}
+
+func (m *marshalerEncoder) AppendString(value string) {
+	m.addElementSeparator()
+	m.enc.writeQuotedString(value)
+}
+
+func (m *marshalerEncoder) AppendTime(value time.Time) {
+	m.addElementSeparator()
+	m.writeTime(value)
+}
+
+func (m *marshalerEncoder) AppendUint(value uint)       { m.AppendUint64(uint64(value)) }
+func (m *marshalerEncoder) AppendUint32(value uint32)   { m.AppendUint64(uint64(value)) }
+func (m *marshalerEncoder) AppendUint16(value uint16)   { m.AppendUint64(uint64(value)) }
+func (m *marshalerEncoder) AppendUint8(value uint8)     { m.AppendUint64(uint64(value)) }
+func (m *marshalerEncoder) AppendUintptr(value uintptr) { m.AppendUint64(uint64(value)) }
+
+func (m *marshalerEncoder) AppendUint64(value uint64) {
+	m.addElementSeparator()
+	m.enc.buf.Write(strconv.AppendUint(m.enc.scratch[:0], value, 10))
+}
+
+func (m *marshalerEncoder) writeBool(value bool) {
+	if value {
+		m.enc.buf.WriteString("true")
+	} else {
+		m.enc.buf.WriteString("false")
+	}
+}
+
+func (m *marshalerEncoder) writeFloat(value float64, bitSize int) {
+	switch {
+	case math.IsNaN(value):
+		m.enc.buf.WriteString(`"NaN"`)
+	case math.IsInf(value, 1):
+		m.enc.buf.WriteString(`"+Inf"`)
+	case math.IsInf(value, -1):
+		m.enc.buf.WriteString(`"-Inf"`)
+	default:
+		m.enc.buf.Write(strconv.AppendFloat(m.enc.scratch[:0], value, 'f', -1, bitSize))
+	}
+}
+
+func (m *marshalerEncoder) writeComplex(value complex128, bitSize int) {
+	r, i := real(value), imag(value)
+	m.enc.buf.WriteByte('"')
+	m.enc.buf.Write(strconv.AppendFloat(m.enc.scratch[:0], r, 'f', -1, bitSize))
+	if i >= 0 {
+		m.enc.buf.WriteByte('+')
+	}
+	m.enc.buf.Write(strconv.AppendFloat(m.enc.scratch[:0], i, 'f', -1, bitSize))
+	m.enc.buf.WriteString(`i"`)
+}
+
+func (m *marshalerEncoder) writeTime(value time.Time) {
+	m.enc.writeQuotedString(value.Format(time.RFC3339))
+}
@@ -0,0 +1,423 @@
+package zaptext
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// encoderFunc writes v, a value of the type the function was compiled for.
+type encoderFunc func(enc *ReflectEncoder, v reflect.Value) error
+
+// typePlan is the compiled encoderFunc of a type. Plans are registered before
+// their type is compiled, so that a recursive type finds its own plan while
+// it's being compiled; ready is closed once encode is set.
+type typePlan struct {
+	ready  chan struct{}
+	encode encoderFunc
+}
+
+// call runs the plan once it's compiled. It stands in for encode wherever the
+// plan is needed before it's ready.
+func (p *typePlan) call(enc *ReflectEncoder, v reflect.Value) error {
+	<-p.ready
+	return p.encode(enc, v)
+}
+
+// plans maps a reflect.Type to its plan, so that the fields, tags and methods
+// of a type are only looked at the first time it's encoded.
+var (
+	plansMu sync.RWMutex
+	plans   = map[reflect.Type]*typePlan{}
+)
+
+// typeEncoder returns the encoderFunc of t, compiling it on first use.
+func typeEncoder(t reflect.Type) encoderFunc {
+	plansMu.RLock()
+	p, found := plans[t]
+	plansMu.RUnlock()
+	if !found {
+		plansMu.Lock()
+		if p, found = plans[t]; !found {
+			p = &typePlan{ready: make(chan struct{})}
+			plans[t] = p
+		}
+		plansMu.Unlock()
+	}
+
+	if !found {
+		p.encode = newTypeEncoder(t)
+		close(p.ready)
+		return p.encode
+	}
+	select {
+	case <-p.ready:
+		return p.encode
+	default:
+		// t is being compiled, by this goroutine if it's recursive.
+		return p.call
+	}
+}
+
+// newTypeEncoder compiles the encoderFunc of t.
+func newTypeEncoder(t reflect.Type) encoderFunc {
+	if t == timeType {
+		return encodeTime
+	}
+	kindEncoder := newKindEncoder(t)
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
+		// Marshalers are looked up on the value pointed to.
+		return kindEncoder
+	}
+
+	// Methods with a pointer receiver are only available on addressable
+	// values.
+	valueKind, addrKind := marshalerOf(t), marshalerOf(reflect.PointerTo(t))
+	if addrKind == noMarshaler {
+		return kindEncoder
+	}
+	return func(enc *ReflectEncoder, v reflect.Value) error {
+		if !v.CanInterface() {
+			return kindEncoder(enc, v)
+		}
+		if v.CanAddr() {
+			return enc.encodeMarshaler(v.Addr(), t)
+		}
+		if valueKind != noMarshaler {
+			return enc.encodeMarshaler(v, t)
+		}
+		return kindEncoder(enc, v)
+	}
+}
+
+func newKindEncoder(t reflect.Type) encoderFunc {
+	switch t.Kind() {
+	case reflect.Bool:
+		return encodeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encodeInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return encodeUint
+	case reflect.Float32:
+		return encodeFloat32
+	case reflect.Float64:
+		return encodeFloat64
+	case reflect.Complex64, reflect.Complex128:
+		return encodeComplex
+	case reflect.String:
+		return encodeStringValue
+	case reflect.Interface:
+		return encodeInterface
+	case reflect.Ptr:
+		return newPtrEncoder(t)
+	case reflect.Array:
+		return newArrayEncoder(t)
+	case reflect.Slice:
+		return newSliceEncoder(t)
+	case reflect.Map:
+		return newMapEncoder(t)
+	case reflect.Struct:
+		return newStructEncoder(t)
+	}
+	// For types we don't handle specifically, such as channels and
+	// functions, convert to string.
+	return encodeUnsupported
+}
+
+func encodeTime(enc *ReflectEncoder, v reflect.Value) error {
+	enc.encodeString(v.Interface().(time.Time).Format(time.RFC3339))
+	return nil
+}
+
+func encodeBool(enc *ReflectEncoder, v reflect.Value) error {
+	if v.Bool() {
+		enc.buf.WriteString("true")
+	} else {
+		enc.buf.WriteString("false")
+	}
+	return nil
+}
+
+func encodeInt(enc *ReflectEncoder, v reflect.Value) error {
+	enc.buf.Write(strconv.AppendInt(enc.scratch[:0], v.Int(), 10))
+	return nil
+}
+
+func encodeUint(enc *ReflectEncoder, v reflect.Value) error {
+	enc.buf.Write(strconv.AppendUint(enc.scratch[:0], v.Uint(), 10))
+	return nil
+}
+
+func encodeFloat32(enc *ReflectEncoder, v reflect.Value) error {
+	enc.buf.Write(strconv.AppendFloat(enc.scratch[:0], v.Float(), 'g', -1, 32))
+	return nil
+}
+
+func encodeFloat64(enc *ReflectEncoder, v reflect.Value) error {
+	enc.buf.Write(strconv.AppendFloat(enc.scratch[:0], v.Float(), 'g', -1, 64))
+	return nil
+}
+
+func encodeComplex(enc *ReflectEncoder, v reflect.Value) error {
+	c := v.Complex()
+	// Use JSON-compatible format: {"real": 1.0, "imag": 2.0}
+	enc.buf.WriteString(`{"real":`)
+	enc.buf.Write(strconv.AppendFloat(enc.scratch[:0], real(c), 'g', -1, 64))
+	enc.buf.WriteString(`,"imag":`)
+	enc.buf.Write(strconv.AppendFloat(enc.scratch[:0], imag(c), 'g', -1, 64))
+	enc.buf.WriteByte('}')
+	return nil
+}
+
+func encodeStringValue(enc *ReflectEncoder, v reflect.Value) error {
+	enc.writeQuotedString(v.String())
+	return nil
+}
+
+func encodeInterface(enc *ReflectEncoder, v reflect.Value) error {
+	if v.IsNil() {
+		enc.buf.WriteString("null")
+		return nil
+	}
+	e := v.Elem()
+	return typeEncoder(e.Type())(enc, e)
+}
+
+func encodeUnsupported(enc *ReflectEncoder, v reflect.Value) error {
+	enc.encodeString(fmt.Sprintf("%v", v.Interface()))
+	return nil
+}
+
+func newPtrEncoder(t reflect.Type) encoderFunc {
+	elemEncoder := typeEncoder(t.Elem())
+	return func(enc *ReflectEncoder, v reflect.Value) error {
+		if v.IsNil() {
+			enc.buf.WriteString("null")
+			return nil
+		}
+		key, ok, err := enc.enter(v)
+		if !ok {
+			return err
+		}
+		err = elemEncoder(enc, v.Elem())
+		enc.leave(key)
+		return err
+	}
+}
+
+func newArrayEncoder(t reflect.Type) encoderFunc {
+	elemEncoder := typeEncoder(t.Elem())
+	return func(enc *ReflectEncoder, v reflect.Value) error {
+		return enc.encodeArray(v, elemEncoder)
+	}
+}
+
+func newSliceEncoder(t reflect.Type) encoderFunc {
+	elemEncoder := typeEncoder(t.Elem())
+	return func(enc *ReflectEncoder, v reflect.Value) error {
+		if v.IsNil() {
+			enc.buf.WriteString("null")
+			return nil
+		}
+		key, ok, err := enc.enter(v)
+		if !ok {
+			return err
+		}
+		err = enc.encodeArray(v, elemEncoder)
+		enc.leave(key)
+		return err
+	}
+}
+
+func (enc *ReflectEncoder) encodeArray(v reflect.Value, elemEncoder encoderFunc) error {
+	enc.buf.WriteByte('[')
+
+	enc.depth++
+	defer func() { enc.depth-- }()
+
+	length := v.Len()
+	for i := 0; i < length; i++ {
+		if i > 0 {
+			enc.buf.WriteByte(',')
+		}
+		if err := enc.checkDepth(); err != nil {
+			return err
+		}
+		if err := elemEncoder(enc, v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	enc.buf.WriteByte(']')
+	return nil
+}
+
+// mapEntry is a map entry along with its key as written.
+type mapEntry struct {
+	key   string
+	value reflect.Value
+}
+
+func newMapEncoder(t reflect.Type) encoderFunc {
+	keyString := mapKeyFormatter(t.Key())
+	elemEncoder := typeEncoder(t.Elem())
+	return func(enc *ReflectEncoder, v reflect.Value) error {
+		if v.IsNil() {
+			enc.buf.WriteString("null")
+			return nil
+		}
+		key, ok, err := enc.enter(v)
+		if !ok {
+			return err
+		}
+		defer enc.leave(key)
+
+		enc.buf.WriteByte('{')
+
+		enc.depth++
+		defer func() { enc.depth-- }()
+
+		// Sort keys for deterministic output
+		entries := make([]mapEntry, 0, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			entries = append(entries, mapEntry{keyString(iter.Key()), iter.Value()})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].key < entries[j].key
+		})
+
+		for i, entry := range entries {
+			if i > 0 {
+				enc.buf.WriteByte(',')
+			}
+
+			enc.writeQuotedString(entry.key)
+			enc.buf.WriteByte(':')
+
+			if err := enc.checkDepth(); err != nil {
+				return err
+			}
+			if err := elemEncoder(enc, entry.value); err != nil {
+				return err
+			}
+		}
+
+		enc.buf.WriteByte('}')
+		return nil
+	}
+}
+
+// mapKeyFormatter returns the function formatting map keys of type t the way
+// fmt's %v verb does, skipping fmt for strings and integers without methods
+// that change their formatting.
+func mapKeyFormatter(t reflect.Type) func(reflect.Value) string {
+	if !t.Implements(marshalerTypes[errorMarshaler]) && !t.Implements(marshalerTypes[stringerMarshaler]) && !t.Implements(formatterType) {
+		switch t.Kind() {
+		case reflect.String:
+			return reflect.Value.String
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return func(v reflect.Value) string { return strconv.FormatInt(v.Int(), 10) }
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return func(v reflect.Value) string { return strconv.FormatUint(v.Uint(), 10) }
+		}
+	}
+	return func(v reflect.Value) string { return fmt.Sprintf("%v", v.Interface()) }
+}
+
+var formatterType = reflect.TypeOf((*fmt.Formatter)(nil)).Elem()
+
+// fieldEncoder is the compiled form of a structField.
+type fieldEncoder struct {
+	structField
+	key     string // the quoted name followed by a colon
+	keyHTML string // key, escaped for HTML
+	encode  encoderFunc
+}
+
+func newStructEncoder(t reflect.Type) encoderFunc {
+	fields := typeFields(t)
+	encoders := make([]fieldEncoder, len(fields))
+	for i, field := range fields {
+		encoders[i] = fieldEncoder{
+			structField: field,
+			key:         fieldKey(field.name, false),
+			keyHTML:     fieldKey(field.name, true),
+			encode:      typeEncoder(field.typ),
+		}
+		if field.quoted && !hasMarshaler(field.typ) {
+			// Like encoding/json, the string option is ignored for types
+			// that encode themselves.
+			encoders[i].encode = (*ReflectEncoder).encodeQuoted
+		}
+	}
+
+	return func(enc *ReflectEncoder, v reflect.Value) error {
+		enc.buf.WriteByte('{')
+
+		enc.depth++
+		defer func() { enc.depth-- }()
+
+		fieldCount := 0
+		for i := range encoders {
+			field := &encoders[i]
+			fieldValue, ok := fieldByIndex(v, field.index)
+			if !ok {
+				// Promoted through a nil embedded pointer
+				continue
+			}
+
+			// Skip nil pointers to avoid encoding null fields in structs
+			// This creates cleaner output by omitting optional fields that are not set
+			if fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil() {
+				continue
+			}
+			if field.omitEmpty && isEmptyValue(fieldValue) {
+				continue
+			}
+
+			if fieldCount > 0 {
+				enc.buf.WriteByte(',')
+			}
+
+			// Always quote field names in JSON format
+			if enc.escapeHTML {
+				enc.buf.WriteString(field.keyHTML)
+			} else {
+				enc.buf.WriteString(field.key)
+			}
+
+			if err := enc.checkDepth(); err != nil {
+				return err
+			}
+			if err := field.encode(enc, fieldValue); err != nil {
+				return err
+			}
+
+			fieldCount++
+		}
+
+		enc.buf.WriteByte('}')
+		return nil
+	}
+}
+
+// hasMarshaler reports whether t, or the type t points to, has a marshaling
+// method, possibly with a pointer receiver.
+func hasMarshaler(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return marshalerOf(reflect.PointerTo(t)) != noMarshaler
+}
+
+// fieldKey returns the key written before the value of the field name.
+func fieldKey(name string, escapeHTML bool) string {
+	enc := &ReflectEncoder{buf: &bytes.Buffer{}, escapeHTML: escapeHTML}
+	enc.writeQuotedString(name)
+	enc.buf.WriteByte(':')
+	return enc.buf.String()
+}
@@ -0,0 +1,99 @@
+package zaptext
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// SanitizePolicy selects how TextEncoder neutralizes the characters of
+// messages and keys that could otherwise forge extra lines or fields when
+// they come from user input. Field values are always quoted and escaped when
+// needed and are not subject to the policy.
+//
+// For messages the unsafe characters are line breaks and other control
+// characters, invalid UTF-8 and '='. For keys they additionally include
+// spaces and '"'.
+type SanitizePolicy int8
+
+const (
+	// SanitizeEscape escapes unsafe characters in place: control characters
+	// and invalid UTF-8 as in quoted values (\n, \u001b, \ufffd), the others
+	// and backslashes themselves with a leading backslash (\=, \\). Leading
+	// and trailing spaces of messages are escaped the same way (\ ), so that
+	// they aren't mistaken for separators. This is the default.
+	SanitizeEscape SanitizePolicy = iota
+	// SanitizeQuote writes a message or key that contains unsafe characters as
+	// a quoted and escaped string, like a field value. Messages with a word
+	// starting with a quote, or starting or ending with a space, are quoted as
+	// well, so that they can't pass for a quoted token.
+	SanitizeQuote
+	// SanitizeReplace replaces every unsafe character with an underscore.
+	SanitizeReplace
+)
+
+func isUnsafeMessageRune(r rune) bool {
+	return r < 0x20 || r == 0x7f || r == utf8.RuneError || r == '='
+}
+
+func isUnsafeKeyRune(r rune) bool {
+	return isUnsafeMessageRune(r) || r == ' ' || r == '"'
+}
+
+// addSanitized writes s, a message or a key, neutralizing the runes for which
+// unsafe returns true according to the configured SanitizePolicy.
+func (enc *TextEncoder) addSanitized(s string, unsafe func(rune) bool) {
+	policy := enc.opts.sanitizePolicy
+	needsSanitizing := strings.IndexFunc(s, unsafe) >= 0 ||
+		(policy == SanitizeEscape && strings.IndexByte(s, '\\') >= 0) ||
+		(policy == SanitizeQuote && (strings.HasPrefix(s, `"`) || strings.Contains(s, ` "`))) ||
+		(policy != SanitizeReplace && hasEdgeSpace(s))
+	if !needsSanitizing {
+		enc.buf.AppendString(s)
+		return
+	}
+
+	switch policy {
+	case SanitizeQuote:
+		enc.buf.AppendByte('"')
+		enc.safeAddString(s)
+		enc.buf.AppendByte('"')
+	case SanitizeReplace:
+		for _, r := range s {
+			if unsafe(r) {
+				enc.buf.AppendByte('_')
+			} else {
+				enc.buf.AppendString(string(r))
+			}
+		}
+	default:
+		enc.escapeUnsafe(s, unsafe)
+	}
+}
+
+// hasEdgeSpace reports whether s starts or ends with a space.
+func hasEdgeSpace(s string) bool {
+	return strings.HasPrefix(s, " ") || strings.HasSuffix(s, " ")
+}
+
+// escapeUnsafe implements SanitizeEscape.
+func (enc *TextEncoder) escapeUnsafe(s string, unsafe func(rune) bool) {
+	lead, trail := len(s)-len(strings.TrimLeft(s, " ")), len(strings.TrimRight(s, " "))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == ' ' && (i < lead || i >= trail):
+			enc.buf.AppendString(`\ `)
+		case enc.tryAddRuneError(r, size):
+		case r < 0x20:
+			enc.tryAddRuneSelf(byte(r))
+		case r == 0x7f:
+			enc.buf.AppendString(`\u007f`)
+		case r == '\\' || unsafe(r):
+			enc.buf.AppendByte('\\')
+			enc.buf.AppendString(s[i : i+size])
+		default:
+			enc.buf.AppendString(s[i : i+size])
+		}
+		i += size
+	}
+}
@@ -0,0 +1,138 @@
+package zaptext_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/kaiiak/zaptext"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTextEncoderSanitizeMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   SanitizePolicy
+		message  string
+		expected string
+	}{
+		{"Escape safe message", SanitizeEscape, "user logged in", "user logged in"},
+		{"Escape line break", SanitizeEscape, "login\nINFO forged", `login\nINFO forged`},
+		{"Escape equals", SanitizeEscape, "user=admin", `user\=admin`},
+		{"Escape backslash", SanitizeEscape, `C:\dir=x`, `C:\\dir\=x`},
+		{"Escape control and invalid UTF-8", SanitizeEscape, "a\x1b\x7f\xffb", `a\u001b\u007f\ufffdb`},
+		{"Escape edge spaces", SanitizeEscape, "  indented  text ", `\ \ indented  text\ `},
+		{"Quote safe message", SanitizeQuote, `C:\dir say hi"`, `C:\dir say hi"`},
+		{"Quote quoted word", SanitizeQuote, `C:\dir say "hi"`, `"C:\\dir say \"hi\""`},
+		{"Quote line break", SanitizeQuote, "login\nINFO forged", `"login\nINFO forged"`},
+		{"Quote equals", SanitizeQuote, `user=admin "x"`, `"user=admin \"x\""`},
+		{"Quote leading quote", SanitizeQuote, `"quoted" text`, `"\"quoted\" text"`},
+		{"Quote edge spaces", SanitizeQuote, " indented", `" indented"`},
+		{"Replace safe message", SanitizeReplace, `C:\dir`, `C:\dir`},
+		{"Replace unsafe characters", SanitizeReplace, "a\nb=c\xffd", "a_b_c_d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewTextEncoder(zapcore.EncoderConfig{MessageKey: "msg"}).(*TextEncoder)
+			enc.SetSanitizePolicy(tt.policy)
+
+			buf, err := enc.EncodeEntry(zapcore.Entry{Message: tt.message}, []zapcore.Field{zap.Int("n", 1)})
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			expected := tt.expected + " n=1\n"
+			if got := buf.String(); got != expected {
+				t.Errorf("Expected %q, got: %q", expected, got)
+			}
+		})
+	}
+}
+
+func TestTextEncoderSanitizeKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   SanitizePolicy
+		key      string
+		expected string
+	}{
+		{"Escape safe key", SanitizeEscape, "user_id", "user_id=1"},
+		{"Escape space and equals", SanitizeEscape, "a b=c", `a\ b\=c=1`},
+		{"Escape quote and line break", SanitizeEscape, "a\"b\nc", `a\"b\nc=1`},
+		{"Quote unsafe key", SanitizeQuote, "a b=c", `"a b=c"=1`},
+		{"Replace unsafe key", SanitizeReplace, "a b=c\n", "a_b_c_=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewTextEncoder(zapcore.EncoderConfig{}).(*TextEncoder)
+			enc.SetSanitizePolicy(tt.policy)
+
+			buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{zap.Int(tt.key, 1)})
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			expected := tt.expected + "\n"
+			if got := buf.String(); got != expected {
+				t.Errorf("Expected %q, got: %q", expected, got)
+			}
+		})
+	}
+
+	t.Run("Namespaces are sanitized", func(t *testing.T) {
+		enc := NewTextEncoder(zapcore.EncoderConfig{})
+		buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{zap.Namespace("a b"), zap.Int("c", 1)})
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		if got := buf.String(); got != "a\\ b.c=1\n" {
+			t.Errorf("Expected %q, got: %q", "a\\ b.c=1\n", got)
+		}
+	})
+
+	t.Run("Quoted namespaces", func(t *testing.T) {
+		cfg := zapcore.EncoderConfig{}
+		opts := []Option{WithSanitizePolicy(SanitizeQuote)}
+		buf, err := NewTextEncoderWithOptions(cfg, opts...).EncodeEntry(zapcore.Entry{}, []zapcore.Field{
+			zap.Namespace("http req"), zap.Int("k", 1), zap.Int("weird key=\n", 2),
+		})
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		expected := `"http req.k"=1 "http req.weird key=\n"=2` + "\n"
+		if got := buf.String(); got != expected {
+			t.Errorf("Expected %q, got: %q", expected, got)
+		}
+
+		rec, err := NewParser(cfg, opts...).Parse(buf.String())
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", buf.String(), err)
+		}
+		if len(rec.Fields) != 2 || rec.Fields[0].Key != "http req.k" || rec.Fields[1].Key != "http req.weird key=\n" {
+			t.Errorf("Unexpected fields in %q: %+v", buf.String(), rec.Fields)
+		}
+	})
+}
+
+func TestTextEncoderKeyedMessage(t *testing.T) {
+	cfg := zapcore.EncoderConfig{LevelKey: "level", MessageKey: "msg", EncodeLevel: zapcore.CapitalLevelEncoder}
+	enc := NewTextEncoder(cfg).(*TextEncoder)
+	enc.SetKeyedMessage(true)
+
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(enc, zapcore.AddSync(&buf), zap.InfoLevel))
+	logger.Info("user logged in\nINFO forged admin=true", zap.String("user", "bob"))
+	logger.Info("ready")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got: %q", buf.String())
+	}
+	if expected := `INFO msg="user logged in\nINFO forged admin=true" user=bob`; lines[0] != expected {
+		t.Errorf("Expected %q, got: %q", expected, lines[0])
+	}
+	if expected := `INFO msg=ready`; lines[1] != expected {
+		t.Errorf("Expected %q, got: %q", expected, lines[1])
+	}
+}
@@ -0,0 +1,118 @@
+package zaptext
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Scanner reads the entries written by a TextEncoder from a stream and
+// decodes them with a Parser. Lines are separated by "\n", optionally
+// preceded by "\r"; the continuation lines of multiline stack traces, which
+// start with a tab, are part of the entry before them. Empty lines are
+// skipped, and ANSI color codes are ignored as by Parser.Parse.
+//
+//	s := zaptext.NewScanner(os.Stdin, parser)
+//	for s.Scan() {
+//		rec, err := s.Record()
+//		...
+//	}
+//	if err := s.Err(); err != nil {
+//		...
+//	}
+type Scanner struct {
+	r      *bufio.Reader
+	parser *Parser
+
+	// next is a line read ahead while looking for continuation lines.
+	next    string
+	hasNext bool
+
+	text string
+	rec  Record
+	err  error // the parse error of the current entry
+	rerr error // the first read error
+}
+
+// NewScanner creates a Scanner that reads entries from r.
+func NewScanner(r io.Reader, parser *Parser) *Scanner {
+	return &Scanner{r: bufio.NewReader(r), parser: parser}
+}
+
+// Scan advances to the next entry, which is then available through Record
+// and Text. It returns false at the end of the input or on a read error.
+// Entries that fail to parse don't stop the scan.
+func (s *Scanner) Scan() bool {
+	s.text, s.rec, s.err = "", Record{}, nil
+	line, ok := s.readLine()
+	for ok && line == "" {
+		line, ok = s.readLine()
+	}
+	if !ok {
+		return false
+	}
+
+	var stack []string
+	for {
+		next, ok := s.readLine()
+		if !ok {
+			break
+		}
+		if !strings.HasPrefix(next, "\t") {
+			s.next, s.hasNext = next, true
+			break
+		}
+		stack = append(stack, next)
+	}
+	if len(stack) > 0 {
+		s.text = line + "\n" + strings.Join(stack, "\n")
+	} else {
+		s.text = line
+	}
+	for i := range stack {
+		stack[i] = stripANSI(stack[i])
+	}
+	s.rec, s.err = s.parser.parse(stripANSI(line), stack)
+	return true
+}
+
+// readLine returns the next line without its line ending.
+func (s *Scanner) readLine() (string, bool) {
+	if s.hasNext {
+		s.hasNext = false
+		return s.next, true
+	}
+	if s.rerr != nil {
+		return "", false
+	}
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		s.rerr = err
+		if line == "" {
+			return "", false
+		}
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), true
+}
+
+// Record returns the entry read by the last call to Scan, and the error that
+// occurred while parsing it.
+func (s *Scanner) Record() (Record, error) {
+	return s.rec, s.err
+}
+
+// Text returns the raw text of the entry read by the last call to Scan,
+// without its final line ending.
+func (s *Scanner) Text() string {
+	return s.text
+}
+
+// Err returns the first read error that was encountered by the Scanner,
+// except io.EOF.
+func (s *Scanner) Err() error {
+	if s.rerr == io.EOF {
+		return nil
+	}
+	return s.rerr
+}
@@ -0,0 +1,87 @@
+package zaptext
+
+import (
+	"strconv"
+	"strings"
+)
+
+// StacktraceFormat selects how TextEncoder renders the stack trace of an
+// entry.
+type StacktraceFormat int8
+
+const (
+	// StacktraceField writes the stack trace as a single escaped
+	// StacktraceKey="..." field at the end of the line. This is the default.
+	StacktraceField StacktraceFormat = iota
+	// StacktraceMultiline writes the stack trace as indented continuation
+	// lines after the main line, for human consumption.
+	StacktraceMultiline
+)
+
+// internalFramePrefixes lists the function name prefixes of the frames that
+// SetStacktraceSkipInternal removes.
+var internalFramePrefixes = []string{
+	"go.uber.org/zap.",
+	"go.uber.org/zap/",
+	"runtime.",
+	"runtime/",
+}
+
+// stackFrame is a single frame of a stack trace formatted by zap: the function
+// name followed by its tab-indented location lines.
+type stackFrame struct {
+	function string
+	lines    []string
+}
+
+// splitStacktrace splits a stack trace formatted by zap into frames.
+func splitStacktrace(stack string) []stackFrame {
+	var frames []stackFrame
+	for _, line := range strings.Split(stack, "\n") {
+		if strings.HasPrefix(line, "\t") && len(frames) > 0 {
+			last := &frames[len(frames)-1]
+			last.lines = append(last.lines, line)
+			continue
+		}
+		frames = append(frames, stackFrame{function: line, lines: []string{line}})
+	}
+	return frames
+}
+
+func isInternalFrame(function string) bool {
+	for _, prefix := range internalFramePrefixes {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatStacktrace applies the frame filter and limit configured in opts to
+// stack and returns its lines.
+func (opts *textOptions) formatStacktrace(stack string) []string {
+	if !opts.skipInternalFrames && opts.maxStackFrames <= 0 {
+		return strings.Split(stack, "\n")
+	}
+
+	var (
+		lines   []string
+		kept    int
+		omitted int
+	)
+	for _, frame := range splitStacktrace(stack) {
+		if opts.skipInternalFrames && isInternalFrame(frame.function) {
+			continue
+		}
+		if opts.maxStackFrames > 0 && kept >= opts.maxStackFrames {
+			omitted++
+			continue
+		}
+		lines = append(lines, frame.lines...)
+		kept++
+	}
+	if omitted > 0 {
+		lines = append(lines, "... "+strconv.Itoa(omitted)+" more frames")
+	}
+	return lines
+}
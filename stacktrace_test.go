@@ -0,0 +1,184 @@
+package zaptext_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/kaiiak/zaptext"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const testStack = "go.uber.org/zap.(*Logger).Error\n" +
+	"\t/go/pkg/mod/go.uber.org/zap/logger.go:220\n" +
+	"main.handle\n" +
+	"\t/src/app/main.go:30\n" +
+	"main.serve\n" +
+	"\t/src/app/main.go:20\n" +
+	"main.main\n" +
+	"\t/src/app/main.go:10\n" +
+	"runtime.main\n" +
+	"\t/usr/local/go/src/runtime/proc.go:250"
+
+func TestTextEncoderStacktrace(t *testing.T) {
+	cfg := zapcore.EncoderConfig{
+		LevelKey:      "level",
+		MessageKey:    "msg",
+		StacktraceKey: "stacktrace",
+		EncodeLevel:   zapcore.CapitalLevelEncoder,
+	}
+	entry := zapcore.Entry{Level: zap.ErrorLevel, Message: "failed", Stack: testStack}
+
+	tests := []struct {
+		name      string
+		configure func(*TextEncoder)
+		expected  string
+	}{
+		{
+			name:      "Escaped field",
+			configure: func(*TextEncoder) {},
+			expected: `ERROR failed key=value stacktrace="` +
+				strings.ReplaceAll(strings.ReplaceAll(testStack, "\n", `\n`), "\t", `\t`) + "\"\n",
+		},
+		{
+			name: "Escaped field without internal frames",
+			configure: func(enc *TextEncoder) {
+				enc.SetStacktraceSkipInternal(true)
+			},
+			expected: `ERROR failed key=value stacktrace="main.handle\n\t/src/app/main.go:30\nmain.serve\n\t/src/app/main.go:20\nmain.main\n\t/src/app/main.go:10"` + "\n",
+		},
+		{
+			name: "Multiline",
+			configure: func(enc *TextEncoder) {
+				enc.SetStacktraceFormat(StacktraceMultiline)
+				enc.SetStacktraceSkipInternal(true)
+			},
+			expected: "ERROR failed key=value\n" +
+				"\tmain.handle\n" +
+				"\t\t/src/app/main.go:30\n" +
+				"\tmain.serve\n" +
+				"\t\t/src/app/main.go:20\n" +
+				"\tmain.main\n" +
+				"\t\t/src/app/main.go:10\n",
+		},
+		{
+			name: "Multiline with frame limit",
+			configure: func(enc *TextEncoder) {
+				enc.SetStacktraceFormat(StacktraceMultiline)
+				enc.SetStacktraceMaxFrames(2)
+			},
+			expected: "ERROR failed key=value\n" +
+				"\tgo.uber.org/zap.(*Logger).Error\n" +
+				"\t\t/go/pkg/mod/go.uber.org/zap/logger.go:220\n" +
+				"\tmain.handle\n" +
+				"\t\t/src/app/main.go:30\n" +
+				"\t... 3 more frames\n",
+		},
+		{
+			name: "Frame limit applies after filtering",
+			configure: func(enc *TextEncoder) {
+				enc.SetStacktraceMaxFrames(1)
+				enc.SetStacktraceSkipInternal(true)
+			},
+			expected: `ERROR failed key=value stacktrace="main.handle\n\t/src/app/main.go:30\n... 2 more frames"` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewTextEncoder(cfg).(*TextEncoder)
+			tt.configure(enc)
+
+			buf, err := enc.EncodeEntry(entry, []zapcore.Field{zap.String("key", "value")})
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("Stack trace is omitted without StacktraceKey", func(t *testing.T) {
+		cfg := cfg
+		cfg.StacktraceKey = ""
+		buf, err := NewTextEncoder(cfg).EncodeEntry(entry, nil)
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		if got := buf.String(); got != "ERROR failed\n" {
+			t.Errorf("Expected stack trace to be omitted, got: %q", got)
+		}
+	})
+
+	t.Run("Stack trace is written outside namespaces", func(t *testing.T) {
+		enc := NewTextEncoder(cfg).(*TextEncoder)
+		enc.SetNestedNamespaces(true)
+		enc.SetStacktraceMaxFrames(1)
+
+		buf, err := enc.EncodeEntry(entry, []zapcore.Field{zap.Namespace("ns"), zap.String("key", "value")})
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		expected := `ERROR failed ns={key=value} stacktrace="go.uber.org/zap.(*Logger).Error\n\t/go/pkg/mod/go.uber.org/zap/logger.go:220\n... 4 more frames"` + "\n"
+		if got := buf.String(); got != expected {
+			t.Errorf("Expected %q, got: %q", expected, got)
+		}
+	})
+
+	t.Run("Multiline with custom line ending", func(t *testing.T) {
+		cfg := cfg
+		cfg.LineEnding = "\r\n"
+		enc := NewTextEncoder(cfg).(*TextEncoder)
+		enc.SetStacktraceFormat(StacktraceMultiline)
+		enc.SetStacktraceMaxFrames(1)
+
+		buf, err := enc.EncodeEntry(entry, nil)
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		expected := "ERROR failed\r\n\tgo.uber.org/zap.(*Logger).Error\r\n\t\t/go/pkg/mod/go.uber.org/zap/logger.go:220\r\n\t... 4 more frames\r\n"
+		if got := buf.String(); got != expected {
+			t.Errorf("Expected %q, got: %q", expected, got)
+		}
+	})
+
+	t.Run("Multiline with skipped line ending", func(t *testing.T) {
+		cfg := cfg
+		cfg.SkipLineEnding = true
+		enc := NewTextEncoder(cfg).(*TextEncoder)
+		enc.SetStacktraceFormat(StacktraceMultiline)
+		enc.SetStacktraceMaxFrames(1)
+
+		buf, err := enc.EncodeEntry(entry, nil)
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		expected := "ERROR failed\n\tgo.uber.org/zap.(*Logger).Error\n\t\t/go/pkg/mod/go.uber.org/zap/logger.go:220\n\t... 4 more frames"
+		if got := buf.String(); got != expected {
+			t.Errorf("Expected %q, got: %q", expected, got)
+		}
+	})
+
+	t.Run("Logger with AddStacktrace", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := NewTextEncoder(cfg).(*TextEncoder)
+		enc.SetStacktraceFormat(StacktraceMultiline)
+		enc.SetStacktraceSkipInternal(true)
+		logger := zap.New(zapcore.NewCore(enc, zapcore.AddSync(&buf), zap.InfoLevel), zap.AddStacktrace(zap.ErrorLevel))
+
+		logger.Error("failed")
+
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if lines[0] != "ERROR failed" {
+			t.Errorf("Expected main line first, got: %q", lines[0])
+		}
+		if len(lines) < 3 || !strings.Contains(lines[1], "TestTextEncoderStacktrace") {
+			t.Errorf("Expected the test function as first frame, got: %q", buf.String())
+		}
+		if strings.Contains(buf.String(), "go.uber.org/zap.") {
+			t.Errorf("Expected zap frames to be filtered, got: %q", buf.String())
+		}
+	})
+}
@@ -2,14 +2,16 @@ package zaptext
 
 import (
 	"encoding/base64"
+	"fmt"
+	"io"
 	"math"
+	"strings"
 	"sync"
 	"time"
 	"unicode/utf8"
 
 	"go.uber.org/zap/buffer"
 	"go.uber.org/zap/zapcore"
-	"golang.org/x/text/encoding"
 )
 
 const (
@@ -20,15 +22,63 @@ type (
 	TextEncoder struct {
 		*zapcore.EncoderConfig
 		buf     *buffer.Buffer
+		opts    textOptions
 		spaced  bool
 		inArray bool // flag to track if we're inside an array
 
+		// namespace is the dotted prefix added to keys by OpenNamespace,
+		// openNamespaces counts the braces left open in nested mode.
+		namespace      string
+		openNamespaces int
+
+		// blockOpened is set right after the brace of an object or nested
+		// namespace is written, so that its first field gets no separator.
+		blockOpened bool
+		// arrayOpened is set right after the bracket of an array is written,
+		// so that its first element gets no comma.
+		arrayOpened bool
+
+		// colorSpan tracks the color span opened by beginColor, errorValue
+		// marks the values of an error field.
+		colorSpan  uint8
+		errorValue bool
+
+		// pad is the number of spaces that align the last column, written
+		// before the next token.
+		pad int
+
 		// for encoding generic values by reflection
 		reflectBuf *buffer.Buffer
-		reflectEnc *encoding.Encoder
 	}
 )
 
+// textOptions holds the TextEncoder settings that have no counterpart in
+// zapcore.EncoderConfig.
+type textOptions struct {
+	nestedNamespaces bool
+	keyedLevel       bool
+	keyedName        bool
+	keyedCaller      bool
+	keyedMessage     bool
+	sanitizePolicy   SanitizePolicy
+	strictLogfmt     bool
+	quotePolicy      QuotePolicy
+	quotePredicate   func(string) bool
+	quote            byte
+
+	stacktraceFormat   StacktraceFormat
+	maxStackFrames     int
+	skipInternalFrames bool
+
+	// colors is resolved from colorMode and colorOutput by updateColors.
+	colorMode   ColorMode
+	colorOutput io.Writer
+	colors      bool
+	palette     *Palette
+
+	columns Columns
+}
+
 var (
 	textpool = sync.Pool{New: func() any {
 		return &TextEncoder{}
@@ -40,27 +90,280 @@ var _ zapcore.Encoder = (*TextEncoder)(nil)
 var _ zapcore.ArrayEncoder = (*TextEncoder)(nil)
 
 func NewTextEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	if cfg.SkipLineEnding {
+		cfg.LineEnding = ""
+	} else if cfg.LineEnding == "" {
+		cfg.LineEnding = zapcore.DefaultLineEnding
+	}
 	return &TextEncoder{EncoderConfig: &cfg, buf: buffpoll.Get()}
 }
 
+// SetNestedNamespaces configures how OpenNamespace is rendered. By default a
+// namespace prefixes the keys of subsequent fields (http.method=GET); when
+// nested is true they are wrapped in a block instead (http={method=GET}).
+func (enc *TextEncoder) SetNestedNamespaces(nested bool) {
+	enc.opts.nestedNamespaces = nested
+}
+
+// SetKeyedLevel configures how the entry level is rendered. By default it is a
+// bare token (INFO); when keyed is true it is written as LevelKey=value
+// (level=info), logfmt style. Either way the value comes from EncodeLevel.
+func (enc *TextEncoder) SetKeyedLevel(keyed bool) {
+	enc.opts.keyedLevel = keyed
+}
+
+// SetKeyedName configures how the logger name is rendered: as a bare token by
+// default, or as NameKey=value when keyed is true.
+func (enc *TextEncoder) SetKeyedName(keyed bool) {
+	enc.opts.keyedName = keyed
+}
+
+// SetKeyedCaller configures how the caller and, when FunctionKey is set, the
+// calling function are rendered: as bare tokens by default, or as
+// CallerKey=value and FunctionKey=value pairs when keyed is true.
+func (enc *TextEncoder) SetKeyedCaller(keyed bool) {
+	enc.opts.keyedCaller = keyed
+}
+
+// SetKeyedMessage configures how the message is rendered: as bare text by
+// default, or as MessageKey=value when keyed is true. A keyed message is
+// quoted and escaped like any other string value.
+func (enc *TextEncoder) SetKeyedMessage(keyed bool) {
+	enc.opts.keyedMessage = keyed
+}
+
+// SetSanitizePolicy configures how unsafe characters in bare messages and in
+// keys are neutralized, see SanitizePolicy.
+func (enc *TextEncoder) SetSanitizePolicy(policy SanitizePolicy) {
+	enc.opts.sanitizePolicy = policy
+}
+
+// SetStrictLogfmt enables strict logfmt compliance. Every token becomes a
+// key=value pair, including the time, level, logger name, caller and message;
+// keys are restricted to the characters logfmt allows, invalid ones being
+// replaced with underscores; and values are quoted and escaped exactly when
+// logfmt requires it. Arrays and objects are written as single string values,
+// namespaces always prefix keys and stack traces are always written as a
+// field, so that every line can be read by standard logfmt parsers.
+func (enc *TextEncoder) SetStrictLogfmt(strict bool) {
+	enc.opts.strictLogfmt = strict
+}
+
+// SetQuotePolicy configures when string values are quoted, see QuotePolicy.
+// It has no effect in strict logfmt mode, which quotes exactly as logfmt
+// requires.
+func (enc *TextEncoder) SetQuotePolicy(policy QuotePolicy) {
+	enc.opts.quotePolicy = policy
+}
+
+// SetQuotePredicate replaces the QuotePolicy with a custom predicate that
+// reports whether a string value is quoted. A nil predicate restores the
+// QuotePolicy.
+func (enc *TextEncoder) SetQuotePredicate(quote func(value string) bool) {
+	enc.opts.quotePredicate = quote
+}
+
+// SetQuoteChar configures the character that delimits quoted values, '"' by
+// default. Inside quoted values the quote character and backslashes are
+// escaped with a backslash. Characters that already have a meaning in the
+// text format, such as '\\', '=' or '{', and non-printable or non-ASCII
+// characters restore the default. Messages and keys quoted by SanitizeQuote
+// always use '"'.
+func (enc *TextEncoder) SetQuoteChar(quote byte) {
+	if !isValidQuoteChar(quote) {
+		quote = 0
+	}
+	enc.opts.quote = quote
+}
+
+// SetColorMode configures whether the level, time, logger name, caller, keys
+// and values are colored with ANSI escape codes, see ColorMode. Bare
+// messages and multiline stack traces are never colored, and strict logfmt
+// arrays and objects are only colored as a whole.
+func (enc *TextEncoder) SetColorMode(mode ColorMode) {
+	enc.opts.colorMode = mode
+	enc.opts.updateColors()
+}
+
+// SetColorOutput sets the writer the encoder's output goes to, which
+// ColorAuto checks for a terminal. Pass the *os.File itself, e.g. os.Stderr:
+// wrappers such as zapcore.Lock hide the terminal.
+func (enc *TextEncoder) SetColorOutput(out io.Writer) {
+	enc.opts.colorOutput = out
+	enc.opts.updateColors()
+}
+
+// SetPalette configures the colors used when colors are enabled, see
+// DefaultPalette.
+func (enc *TextEncoder) SetPalette(palette Palette) {
+	enc.opts.palette = &palette
+}
+
+// SetColumns configures the widths of the level, logger name, caller and
+// message columns, see Columns. The zero value disables alignment.
+func (enc *TextEncoder) SetColumns(columns Columns) {
+	enc.opts.columns = columns
+}
+
+// SetStacktraceFormat configures how the stack trace of an entry is rendered,
+// see StacktraceFormat. Stack traces are only written when StacktraceKey is
+// set.
+func (enc *TextEncoder) SetStacktraceFormat(format StacktraceFormat) {
+	enc.opts.stacktraceFormat = format
+}
+
+// SetStacktraceMaxFrames limits the number of frames written for a stack
+// trace; the omitted frames are summarized on a final line. Zero or a
+// negative value means no limit.
+func (enc *TextEncoder) SetStacktraceMaxFrames(frames int) {
+	enc.opts.maxStackFrames = frames
+}
+
+// SetStacktraceSkipInternal configures whether frames of zap itself and of the
+// Go runtime are dropped from stack traces.
+func (enc *TextEncoder) SetStacktraceSkipInternal(skip bool) {
+	enc.opts.skipInternalFrames = skip
+}
+
 func (enc *TextEncoder) addKey(key string) {
 	enc.addElementSeparator()
-	enc.buf.AppendString(key)
+	began := enc.beginColor(colorKey)
+	if enc.opts.strictLogfmt {
+		if enc.namespace == "" && key == "" {
+			key = "_"
+		}
+		enc.addLogfmtKey(enc.namespace)
+		enc.addLogfmtKey(key)
+	} else {
+		// The prefix and the key are sanitized as one key, so that quoting
+		// can't split it in two.
+		enc.addSanitized(enc.namespace+key, isUnsafeKeyRune)
+	}
+	enc.endColor(began)
 	enc.buf.AppendByte('=')
 }
 
 func (enc *TextEncoder) addElementSeparator() {
+	for ; enc.pad > 0; enc.pad-- {
+		enc.buf.AppendByte(' ')
+	}
+	if enc.blockOpened {
+		enc.blockOpened = false
+		return
+	}
 	if enc.buf.Len() > 0 {
 		enc.buf.AppendByte(' ')
 	}
 }
 
-func (enc *TextEncoder) addArrayElementSeparator() {
-	if enc.inArray && enc.buf.Len() > 0 {
-		last := enc.buf.Bytes()[enc.buf.Len()-1]
-		if last != '[' && last != '{' {
-			enc.buf.AppendByte(',')
+// addKeyedToken writes a piece of entry metadata as key=value, running encode
+// against the encoder itself like zap's JSON encoder does. fallback is used
+// when encode is nil or appends nothing. The value is colored as role and,
+// for a positive width, aligned to width cells.
+func (enc *TextEncoder) addKeyedToken(key string, role colorRole, width int, encode func(zapcore.PrimitiveArrayEncoder), fallback string) {
+	enc.addKey(key)
+	if width > 0 {
+		enc.addColumn(width, role, tokenText(encode, fallback), (*TextEncoder).appendStringValue)
+		return
+	}
+	began := enc.beginColor(role)
+	cur := enc.buf.Len()
+	if encode != nil {
+		encode(enc)
+	}
+	if cur == enc.buf.Len() {
+		enc.AppendString(fallback)
+	}
+	enc.endColor(began)
+}
+
+// addBareToken writes a piece of entry metadata as a bare token. Like zap's
+// console encoder, the elements appended by encode are collected and printed
+// as-is rather than quoted. fallback is used when encode is nil or appends
+// nothing. The token is colored as role and, for a positive width, aligned to
+// width cells.
+func (enc *TextEncoder) addBareToken(role colorRole, width int, encode func(zapcore.PrimitiveArrayEncoder), fallback string) {
+	if width > 0 {
+		text := tokenText(encode, fallback)
+		enc.addElementSeparator()
+		enc.addColumn(width, role, text, appendRaw)
+		return
+	}
+	arr := getSliceEncoder()
+	if encode != nil {
+		encode(arr)
+	}
+	enc.addElementSeparator()
+	began := enc.beginColor(role)
+	if len(arr.elems) == 0 {
+		enc.buf.AppendString(fallback)
+	}
+	for i, elem := range arr.elems {
+		if i > 0 {
+			enc.buf.AppendByte(' ')
+		}
+		fmt.Fprint(enc.buf, elem)
+	}
+	enc.endColor(began)
+	putSliceEncoder(arr)
+}
+
+// tokenText returns the elements appended by encode joined by spaces, or
+// fallback when there are none.
+func tokenText(encode func(zapcore.PrimitiveArrayEncoder), fallback string) string {
+	arr := getSliceEncoder()
+	defer putSliceEncoder(arr)
+
+	if encode != nil {
+		encode(arr)
+	}
+	if len(arr.elems) == 0 {
+		return fallback
+	}
+	var sb strings.Builder
+	for i, elem := range arr.elems {
+		if i > 0 {
+			sb.WriteByte(' ')
 		}
+		fmt.Fprint(&sb, elem)
+	}
+	return sb.String()
+}
+
+func (enc *TextEncoder) closeOpenNamespaces() {
+	for i := 0; i < enc.openNamespaces; i++ {
+		enc.buf.AppendByte('}')
+	}
+	enc.openNamespaces = 0
+	enc.blockOpened = false
+}
+
+// marshalObject writes the braced object produced by marshaler. The object
+// gets a clean namespace scope, so that keys inside it are relative to it and
+// namespaces opened by the marshaler are closed before the object is, and its
+// fields are space separated even when the object is an array element.
+func (enc *TextEncoder) marshalObject(marshaler zapcore.ObjectMarshaler) error {
+	namespace, openNamespaces, inArray := enc.namespace, enc.openNamespaces, enc.inArray
+	enc.namespace, enc.openNamespaces, enc.inArray = "", 0, false
+	enc.buf.AppendByte('{')
+	enc.blockOpened = true
+	err := marshaler.MarshalLogObject(enc)
+	enc.closeOpenNamespaces()
+	enc.buf.AppendByte('}')
+	enc.namespace, enc.openNamespaces, enc.inArray = namespace, openNamespaces, inArray
+	return err
+}
+
+func (enc *TextEncoder) addArrayElementSeparator() {
+	if !enc.inArray {
+		return
+	}
+	if enc.arrayOpened {
+		enc.arrayOpened = false
+		return
+	}
+	if enc.buf.Len() > 0 {
+		enc.buf.AppendByte(',')
 	}
 }
 
@@ -104,6 +407,7 @@ func (enc *TextEncoder) tryAddRuneSelf(b byte) bool {
 }
 
 func (enc *TextEncoder) appendFloat(val float64, bitSize int) {
+	began := enc.beginColor(colorNumber)
 	switch {
 	case math.IsNaN(val):
 		enc.buf.AppendString(`"NaN"`)
@@ -114,6 +418,7 @@ func (enc *TextEncoder) appendFloat(val float64, bitSize int) {
 	default:
 		enc.buf.AppendFloat(val, bitSize)
 	}
+	enc.endColor(began)
 }
 
 func (enc *TextEncoder) appendFloatWithSeparator(val float64, bitSize int) {
@@ -121,6 +426,25 @@ func (enc *TextEncoder) appendFloatWithSeparator(val float64, bitSize int) {
 	enc.appendFloat(val, bitSize)
 }
 
+// safeAddString JSON-escapes a string and appends it to the internal buffer.
+// Unlike the standard library's encoder, it doesn't attempt to protect the
+// user from browser vulnerabilities or JSONP-related problems.
+func (enc *TextEncoder) safeAddString(s string) {
+	for i := 0; i < len(s); {
+		if enc.tryAddRuneSelf(s[i]) {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if enc.tryAddRuneError(r, size) {
+			i++
+			continue
+		}
+		enc.buf.AppendString(s[i : i+size])
+		i += size
+	}
+}
+
 // safeAddByteString is no-alloc equivalent of safeAddString(string(s)) for s []byte.
 func (enc *TextEncoder) safeAddByteString(s []byte) {
 	for i := 0; i < len(s); {
@@ -139,14 +463,15 @@ func (enc *TextEncoder) safeAddByteString(s []byte) {
 }
 
 // Clone copies the encoder, ensuring that adding fields to the copy doesn't
-// affect the original.
+// affect the original. Fields already added to the encoder, e.g. through
+// logger.With, are carried over to the copy.
 func (enc *TextEncoder) Clone() zapcore.Encoder {
-	return &TextEncoder{
-		EncoderConfig: enc.EncoderConfig,
-		buf:           buffpoll.Get(),
-		spaced:        enc.spaced,
-		inArray:       false,
-	}
+	clone := enc.clone()
+	_, _ = clone.buf.Write(enc.buf.Bytes())
+	clone.namespace = enc.namespace
+	clone.openNamespaces = enc.openNamespaces
+	clone.blockOpened = enc.blockOpened
+	return clone
 }
 
 // EncodeEntry encodes an entry and fields, along with any accumulated
@@ -157,70 +482,200 @@ func (enc *TextEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (
 
 	// Add timestamp
 	if final.TimeKey != "" && !ent.Time.IsZero() {
-		final.AddTime(final.TimeKey, ent.Time)
+		final.addKey(final.TimeKey)
+		began := final.beginColor(colorTime)
+		final.appendTimeValue(ent.Time)
+		final.endColor(began)
 	}
 
 	// Add level
+	columns := final.opts.columns
 	if final.LevelKey != "" {
-		final.addElementSeparator()
-		final.buf.AppendString(ent.Level.CapitalString())
+		var encodeLevel func(zapcore.PrimitiveArrayEncoder)
+		if e := final.EncodeLevel; e != nil {
+			encodeLevel = func(arr zapcore.PrimitiveArrayEncoder) { e(ent.Level, arr) }
+		}
+		if final.opts.keyedLevel || final.opts.strictLogfmt {
+			final.addKeyedToken(final.LevelKey, levelColorRole(ent.Level), columns.Level, encodeLevel, ent.Level.CapitalString())
+		} else {
+			final.addBareToken(levelColorRole(ent.Level), columns.Level, encodeLevel, ent.Level.CapitalString())
+		}
+	}
+
+	// Add logger name
+	if ent.LoggerName != "" && final.NameKey != "" {
+		nameEncoder := final.EncodeName
+		if nameEncoder == nil {
+			// Fall back to FullNameEncoder like zap's own encoders.
+			nameEncoder = zapcore.FullNameEncoder
+		}
+		encodeName := func(arr zapcore.PrimitiveArrayEncoder) { nameEncoder(ent.LoggerName, arr) }
+		if final.opts.keyedName || final.opts.strictLogfmt {
+			final.addKeyedToken(final.NameKey, colorName, columns.Name, encodeName, ent.LoggerName)
+		} else {
+			final.addBareToken(colorName, columns.Name, encodeName, ent.LoggerName)
+		}
+	} else if final.NameKey != "" && !final.opts.keyedName && !final.opts.strictLogfmt {
+		final.skipColumn(columns.Name)
 	}
 
 	// Add caller info if enabled
-	if final.CallerKey != "" && ent.Caller.Defined {
-		final.addElementSeparator()
-		final.buf.AppendString(ent.Caller.TrimmedPath())
+	if ent.Caller.Defined {
+		if final.CallerKey != "" {
+			var encodeCaller func(zapcore.PrimitiveArrayEncoder)
+			if e := final.EncodeCaller; e != nil {
+				encodeCaller = func(arr zapcore.PrimitiveArrayEncoder) { e(ent.Caller, arr) }
+			}
+			if final.opts.keyedCaller || final.opts.strictLogfmt {
+				final.addKeyedToken(final.CallerKey, colorCaller, columns.Caller, encodeCaller, ent.Caller.TrimmedPath())
+			} else {
+				final.addBareToken(colorCaller, columns.Caller, encodeCaller, ent.Caller.TrimmedPath())
+			}
+		}
+		if final.FunctionKey != "" && ent.Caller.Function != "" {
+			if final.opts.keyedCaller || final.opts.strictLogfmt {
+				final.addKey(final.FunctionKey)
+				began := final.beginColor(colorCaller)
+				final.appendStringValue(ent.Caller.Function)
+				final.endColor(began)
+			} else {
+				final.addElementSeparator()
+				began := final.beginColor(colorCaller)
+				final.buf.AppendString(ent.Caller.Function)
+				final.endColor(began)
+			}
+		}
+	} else if final.CallerKey != "" && !final.opts.keyedCaller && !final.opts.strictLogfmt {
+		final.skipColumn(columns.Caller)
 	}
 
 	// Add message
 	if final.MessageKey != "" && ent.Message != "" {
-		final.addElementSeparator()
-		final.buf.AppendString(ent.Message)
+		if final.opts.keyedMessage || final.opts.strictLogfmt {
+			final.addKey(final.MessageKey)
+			final.addColumn(columns.Message, colorMessage, ent.Message, (*TextEncoder).appendStringValue)
+		} else {
+			final.addElementSeparator()
+			final.addColumn(columns.Message, colorMessage, ent.Message, appendMessage)
+		}
+	} else if final.MessageKey != "" && !final.opts.keyedMessage && !final.opts.strictLogfmt {
+		final.skipColumn(columns.Message)
 	}
 
-	// Add fields
+	// Add context accumulated through With, then the entry's own fields,
+	// which belong to any namespace the context left open
+	if enc.buf.Len() > 0 {
+		final.addElementSeparator()
+		_, _ = final.buf.Write(enc.buf.Bytes())
+		final.blockOpened = enc.blockOpened
+	}
+	final.namespace = enc.namespace
+	final.openNamespaces = enc.openNamespaces
 	for _, field := range fields {
+		final.errorValue = field.Type == zapcore.ErrorType
 		field.AddTo(final)
 	}
+	final.errorValue = false
+	final.closeOpenNamespaces()
+	final.namespace = ""
+
+	// Add stack trace, either as the last field or as continuation lines
+	var stack []string
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		stack = final.opts.formatStacktrace(ent.Stack)
+		if final.opts.stacktraceFormat != StacktraceMultiline || final.opts.strictLogfmt {
+			final.addKey(final.StacktraceKey)
+			final.buf.AppendByte('"')
+			for i, line := range stack {
+				if i > 0 {
+					final.buf.AppendString(`\n`)
+				}
+				final.safeAddString(line)
+			}
+			final.buf.AppendByte('"')
+			stack = nil
+		}
+	}
 
-	// Add newline
-	final.buf.AppendByte('\n')
+	// Continuation lines are separated by the line ending even when the
+	// final one is skipped
+	if len(stack) > 0 {
+		separator := final.LineEnding
+		if separator == "" {
+			separator = zapcore.DefaultLineEnding
+		}
+		for _, line := range stack {
+			final.buf.AppendString(separator)
+			final.buf.AppendByte('\t')
+			final.buf.AppendString(line)
+		}
+	}
+	final.buf.AppendString(final.LineEnding)
 
-	return final.buf, nil
+	ret := final.buf
+	putTextEncoder(final)
+	return ret, nil
 }
 
+// clone returns a pooled copy of enc with the same configuration and an empty
+// buffer. The buffer is always fresh from the pool, since the one handed out
+// by a previous EncodeEntry belongs to the caller.
 func (enc *TextEncoder) clone() *TextEncoder {
 	clone := textpool.Get().(*TextEncoder)
 	clone.EncoderConfig = enc.EncoderConfig
-	if clone.buf != nil {
-		clone.buf.Reset()
-	} else {
-		clone.buf = buffpoll.Get()
-	}
+	clone.buf = buffpoll.Get()
+	clone.opts = enc.opts
 	clone.spaced = enc.spaced
 	clone.inArray = false
-	clone.reflectBuf = nil
-	clone.reflectEnc = nil
 	return clone
 }
 
+func putTextEncoder(enc *TextEncoder) {
+	if enc.reflectBuf != nil {
+		enc.reflectBuf.Free()
+	}
+	enc.EncoderConfig = nil
+	enc.buf = nil
+	enc.opts = textOptions{}
+	enc.spaced = false
+	enc.inArray = false
+	enc.namespace = ""
+	enc.openNamespaces = 0
+	enc.blockOpened = false
+	enc.arrayOpened = false
+	enc.colorSpan = colorSpanNone
+	enc.errorValue = false
+	enc.pad = 0
+	enc.reflectBuf = nil
+	textpool.Put(enc)
+}
+
 // Logging-specific marshalers.
 func (enc *TextEncoder) AddArray(key string, marshaler zapcore.ArrayMarshaler) (err error) {
 	enc.addKey(key)
-	enc.buf.AppendByte('[')
-	prevInArray := enc.inArray
-	enc.inArray = true
-	err = marshaler.MarshalLogArray(enc)
-	enc.inArray = prevInArray
-	enc.buf.AppendByte(']')
-	return
+	if enc.opts.strictLogfmt {
+		return enc.addFlattened(func(scratch *TextEncoder) error { return scratch.marshalArray(marshaler) })
+	}
+	return enc.marshalArray(marshaler)
 }
 func (enc *TextEncoder) AddObject(key string, marshaler zapcore.ObjectMarshaler) (err error) {
 	enc.addKey(key)
-	enc.buf.AppendByte('{')
-	err = marshaler.MarshalLogObject(enc)
-	enc.buf.AppendByte('}')
-	return
+	if enc.opts.strictLogfmt {
+		return enc.addFlattened(func(scratch *TextEncoder) error { return scratch.marshalObject(marshaler) })
+	}
+	return enc.marshalObject(marshaler)
+}
+
+// marshalArray writes the bracketed, comma separated array produced by
+// marshaler.
+func (enc *TextEncoder) marshalArray(marshaler zapcore.ArrayMarshaler) error {
+	enc.buf.AppendByte('[')
+	prevInArray := enc.inArray
+	enc.inArray, enc.arrayOpened = true, true
+	err := marshaler.MarshalLogArray(enc)
+	enc.inArray, enc.arrayOpened = prevInArray, false
+	enc.buf.AppendByte(']')
+	return err
 }
 
 func (enc *TextEncoder) AddComplex64(key string, value complex64) {
@@ -260,10 +715,6 @@ func (enc *TextEncoder) AddUintptr(key string, value uintptr) {
 func (enc *TextEncoder) resetReflectBuf() {
 	if enc.reflectBuf == nil {
 		enc.reflectBuf = buffpoll.Get()
-		enc.reflectEnc = &encoding.Encoder{}
-
-		// For consistency with our custom JSON encoder.
-		// enc.reflectEnc.SetEscapeHTML(false)
 	} else {
 		enc.reflectBuf.Reset()
 	}
@@ -271,14 +722,14 @@ func (enc *TextEncoder) resetReflectBuf() {
 
 var nullLiteralBytes = []byte("null")
 
-func (enc *TextEncoder) encodeReflected(obj any) ([]byte, error) {
+// encodeReflected encodes obj into reflectBuf. composite reports whether obj
+// went through ReflectEncoder rather than being a nil, number or boolean.
+func (enc *TextEncoder) encodeReflected(obj any) (_ []byte, composite bool, _ error) {
 	if obj == nil {
-		return nullLiteralBytes, nil
+		return nullLiteralBytes, false, nil
 	}
 	enc.resetReflectBuf()
 	switch v := obj.(type) {
-	case string:
-		enc.reflectBuf.AppendString(v)
 	case int:
 		enc.reflectBuf.AppendInt(int64(v))
 	case int64:
@@ -310,30 +761,49 @@ func (enc *TextEncoder) encodeReflected(obj any) ([]byte, error) {
 			enc.reflectBuf.AppendString("false")
 		}
 	default:
-		// 复杂类型可以用 encoding/json 或自定义反射逻辑
-		// 这里简单处理为 null
-		return nullLiteralBytes, nil
+		// Structs, maps, slices and the like go through ReflectEncoder, which
+		// only writes to reflectBuf once the whole value encoded successfully.
+		re := NewReflectEncoder(enc.reflectBuf)
+		err := re.Encode(obj)
+		re.Release()
+		if err != nil {
+			return nil, false, err
+		}
+		composite = true
 	}
-	return enc.reflectBuf.Bytes(), nil
+	return enc.reflectBuf.Bytes(), composite, nil
 }
 
 // AddReflected uses reflection to serialize arbitrary objects, so it can be
-// slow and allocation-heavy.
+// slow and allocation-heavy. Strings are written like AddString would; on
+// error nothing is written, and zap reports the error as a <key>Error field.
 func (enc *TextEncoder) AddReflected(key string, value any) (err error) {
-	var valueBytes []byte
-	valueBytes, err = enc.encodeReflected(value)
+	if s, ok := value.(string); ok {
+		enc.AddString(key, s)
+		return nil
+	}
+	valueBytes, composite, err := enc.encodeReflected(value)
 	if err != nil {
 		return err
 	}
 	enc.addKey(key)
-	_, err = enc.buf.Write(valueBytes)
-	return
+	enc.appendReflectedValue(valueBytes, composite)
+	return nil
 }
 
 // OpenNamespace opens an isolated namespace where all subsequent fields will
 // be added. Applications can use namespaces to prevent key collisions when
 // injecting loggers into sub-components or third-party libraries.
-func (enc *TextEncoder) OpenNamespace(key string) {}
+func (enc *TextEncoder) OpenNamespace(key string) {
+	if enc.opts.nestedNamespaces && !enc.opts.strictLogfmt {
+		enc.addKey(key)
+		enc.buf.AppendByte('{')
+		enc.blockOpened = true
+		enc.openNamespaces++
+		return
+	}
+	enc.namespace += key + "."
+}
 
 // Built-in types.
 // for arbitrary bytes
@@ -347,11 +817,16 @@ func (enc *TextEncoder) AddDuration(key string, value time.Duration) {
 		e(value, enc)
 	}
 	if cur == enc.buf.Len() {
-		enc.buf.AppendString(value.String())
+		enc.appendStringValue(value.String())
 	}
 }
 func (enc *TextEncoder) AddComplex128(key string, value complex128) {
 	enc.addKey(key)
+	enc.appendComplex(value)
+}
+
+func (enc *TextEncoder) appendComplex(value complex128) {
+	began := enc.beginColor(colorNumber)
 	// Cast to a platform-independent, fixed-size type.
 	r, i := float64(real(value)), float64(imag(value))
 	enc.buf.AppendByte('"')
@@ -364,6 +839,7 @@ func (enc *TextEncoder) AddComplex128(key string, value complex128) {
 	enc.buf.AppendFloat(i, 64)
 	enc.buf.AppendByte('i')
 	enc.buf.AppendByte('"')
+	enc.endColor(began)
 }
 func (enc *TextEncoder) AddByteString(key string, value []byte) {
 	enc.addKey(key)
@@ -375,37 +851,82 @@ func (enc *TextEncoder) AddFloat64(key string, value float64) {
 }
 func (enc *TextEncoder) AddTime(key string, value time.Time) {
 	enc.addKey(key)
+	enc.appendTimeValue(value)
+}
+
+func (enc *TextEncoder) appendTimeValue(value time.Time) {
 	cur := enc.buf.Len()
 	if e := enc.EncodeTime; e != nil {
 		e(value, enc)
 	}
 	if cur == enc.buf.Len() {
 		// User-supplied EncodeTime is a no-op.
-		enc.buf.AppendTime(value, time.RFC3339)
+		enc.appendStringValue(value.Format(time.RFC3339))
 	}
 }
 func (enc *TextEncoder) AddUint64(key string, value uint64) {
 	enc.addKey(key)
+	began := enc.beginColor(colorNumber)
 	enc.buf.AppendUint(value)
+	enc.endColor(began)
 }
 func (enc *TextEncoder) AddInt64(key string, value int64) {
 	enc.addKey(key)
+	began := enc.beginColor(colorNumber)
 	enc.buf.AppendInt(value)
+	enc.endColor(began)
 }
 func (enc *TextEncoder) AddBool(key string, value bool) {
 	enc.addKey(key)
+	began := enc.beginColor(colorBool)
 	enc.buf.AppendBool(value)
+	enc.endColor(began)
 }
 func (enc *TextEncoder) AddString(key, value string) {
 	enc.addKey(key)
-	// For text format, we'll add quotes only if the value contains spaces or special characters
-	if needsQuoting(value) {
-		enc.buf.AppendByte('"')
-		enc.buf.AppendString(value)
-		enc.buf.AppendByte('"')
-	} else {
+	enc.appendStringValue(value)
+}
+
+// appendStringValue writes a string value, quoted according to the
+// configured QuotePolicy. By default we'll add quotes only if the value
+// contains spaces or special characters, and escape the content of quoted
+// values so that they can't break the line.
+func (enc *TextEncoder) appendStringValue(value string) {
+	role := colorString
+	if enc.errorValue {
+		role = colorError
+	}
+	began := enc.beginColor(role)
+	switch {
+	case enc.opts.strictLogfmt:
+		if needsLogfmtQuoting(value) {
+			enc.buf.AppendByte('"')
+			enc.safeAddString(value)
+			enc.buf.AppendByte('"')
+		} else {
+			enc.buf.AppendString(value)
+		}
+	case enc.opts.shouldQuote(value):
+		enc.addQuoted(value)
+	case enc.opts.quotePolicy == QuoteWhenNeeded && enc.opts.quotePredicate == nil:
+		// needsQuoting already sent everything that needs escaping to the
+		// quoted branch.
 		enc.buf.AppendString(value)
+	default:
+		enc.addUnquoted(value)
+	}
+	enc.endColor(began)
+}
+
+// appendReflectedValue writes the output of encodeReflected. Arrays, maps and
+// structs are written as is unless strict logfmt mode or a non-default quoting
+// policy treats them as strings.
+func (enc *TextEncoder) appendReflectedValue(value []byte, composite bool) {
+	if composite && (enc.opts.strictLogfmt || enc.opts.quotePolicy != QuoteWhenNeeded || enc.opts.quotePredicate != nil) {
+		enc.appendStringValue(string(value))
+		return
 	}
+	_, _ = enc.buf.Write(value)
 }
 
 // needsQuoting returns true if the string needs to be quoted in text format
@@ -414,7 +935,12 @@ func needsQuoting(s string) bool {
 		return true
 	}
 	for _, r := range s {
-		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '"' || r == '=' || r == '{' || r == '}' || r == '[' || r == ']' || r == ',' || r == ':' {
+		if r == ' ' || r == '"' || r == '=' || r == '{' || r == '}' || r == '[' || r == ']' || r == ',' || r == ':' {
+			return true
+		}
+		// Control characters and invalid UTF-8 are escaped, which is only
+		// unambiguous inside quotes.
+		if r < 0x20 || r == 0x7f || r == utf8.RuneError {
 			return true
 		}
 	}
@@ -449,79 +975,68 @@ func (enc *TextEncoder) AppendTime(value time.Time) {
 // Logging-specific marshalers.{}
 func (enc *TextEncoder) AppendArray(arr zapcore.ArrayMarshaler) (err error) {
 	enc.addArrayElementSeparator()
-	enc.buf.AppendByte('[')
-	prevInArray := enc.inArray
-	enc.inArray = true
-	err = arr.MarshalLogArray(enc)
-	enc.inArray = prevInArray
-	enc.buf.AppendByte(']')
-	return
+	return enc.marshalArray(arr)
 }
 
 func (enc *TextEncoder) AppendObject(obj zapcore.ObjectMarshaler) (err error) {
-	enc.addElementSeparator()
-	err = obj.MarshalLogObject(enc)
+	enc.addArrayElementSeparator()
+	err = enc.marshalObject(obj)
 	return
 }
 
 // AppendReflected uses reflection to serialize arbitrary objects, so it's
 // slow and allocation-heavy.
 func (enc *TextEncoder) AppendReflected(value any) (err error) {
-	valueBytes, err := enc.encodeReflected(value)
+	if s, ok := value.(string); ok {
+		enc.AppendString(s)
+		return nil
+	}
+	valueBytes, composite, err := enc.encodeReflected(value)
 	if err != nil {
 		return err
 	}
 	enc.addArrayElementSeparator()
-	_, err = enc.buf.Write(valueBytes)
-	return
+	enc.appendReflectedValue(valueBytes, composite)
+	return nil
 }
 
 func (enc *TextEncoder) AppendBool(value bool) {
 	enc.addArrayElementSeparator()
+	began := enc.beginColor(colorBool)
 	enc.buf.AppendBool(value)
+	enc.endColor(began)
 }
 
 // for UTF-8 encoded bytes
 func (enc *TextEncoder) AppendByteString(value []byte) {
 	enc.addArrayElementSeparator()
+	began := enc.beginColor(colorString)
 	enc.buf.AppendByte('"')
 	enc.safeAddByteString(value)
 	enc.buf.AppendByte('"')
+	enc.endColor(began)
 }
 
 func (enc *TextEncoder) AppendComplex128(value complex128) {
 	enc.addArrayElementSeparator()
-	// Cast to a platform-independent, fixed-size type.
-	r, i := float64(real(value)), float64(imag(value))
-	enc.buf.AppendByte('"')
-	// Because we're always in a quoted string, we can use strconv without
-	// special-casing NaN and +/-Inf.
-	enc.buf.AppendFloat(r, 64)
-	if i >= 0 {
-		enc.buf.AppendByte('+')
-	}
-	enc.buf.AppendFloat(i, 64)
-	enc.buf.AppendByte('i')
-	enc.buf.AppendByte('"')
+	enc.appendComplex(value)
 }
 
 func (enc *TextEncoder) AppendUint64(value uint64) {
 	enc.addArrayElementSeparator()
+	began := enc.beginColor(colorNumber)
 	enc.buf.AppendUint(value)
+	enc.endColor(began)
 }
 func (enc *TextEncoder) AppendString(value string) {
 	enc.addArrayElementSeparator()
-	if needsQuoting(value) {
-		enc.buf.AppendByte('"')
-		enc.buf.AppendString(value)
-		enc.buf.AppendByte('"')
-	} else {
-		enc.buf.AppendString(value)
-	}
+	enc.appendStringValue(value)
 }
 func (enc *TextEncoder) AppendInt64(value int64) {
 	enc.addArrayElementSeparator()
+	began := enc.beginColor(colorNumber)
 	enc.buf.AppendInt(value)
+	enc.endColor(began)
 }
 func (enc *TextEncoder) AppendFloat64(value float64) {
 	enc.appendFloatWithSeparator(value, 64)
@@ -3,6 +3,7 @@ package zaptext_test
 import (
 	"bytes"
 	"math"
+	"net"
 	"strings"
 	"testing"
 	"time"
@@ -399,6 +400,70 @@ func TestTextEncoderClone(t *testing.T) {
 	}
 }
 
+func TestTextEncoderWithContext(t *testing.T) {
+	cfg := zap.NewProductionEncoderConfig()
+	cfg.TimeKey = ""
+
+	t.Run("Context fields follow the message", func(t *testing.T) {
+		var buf bytes.Buffer
+		core := zapcore.NewCore(NewTextEncoder(cfg), zapcore.AddSync(&buf), zap.InfoLevel)
+		logger := zap.New(core).With(zap.String("request_id", "abc"), zap.Int("attempt", 2))
+
+		logger.Info("test message", zap.String("key", "value"))
+
+		output := strings.TrimSpace(buf.String())
+		expected := "info test message request_id=abc attempt=2 key=value"
+		if output != expected {
+			t.Errorf("Expected %q, got: %q", expected, output)
+		}
+	})
+
+	t.Run("Child loggers accumulate context", func(t *testing.T) {
+		var buf bytes.Buffer
+		core := zapcore.NewCore(NewTextEncoder(cfg), zapcore.AddSync(&buf), zap.InfoLevel)
+		parent := zap.New(core).With(zap.String("service", "api"))
+		child := parent.With(zap.String("handler", "users"))
+
+		child.Info("child message")
+		parent.Info("parent message")
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 lines, got: %q", buf.String())
+		}
+		if lines[0] != "info child message service=api handler=users" {
+			t.Errorf("Unexpected child output: %q", lines[0])
+		}
+		if lines[1] != "info parent message service=api" {
+			t.Errorf("Expected parent to be unaffected by child context, got: %q", lines[1])
+		}
+	})
+
+	t.Run("Clone keeps accumulated fields", func(t *testing.T) {
+		enc := NewTextEncoder(cfg)
+		enc.AddString("base", "value")
+
+		clone := enc.Clone()
+		clone.AddString("extra", "field")
+
+		buf, err := clone.EncodeEntry(zapcore.Entry{Message: "msg"}, nil)
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		if got := buf.String(); got != "info msg base=value extra=field\n" {
+			t.Errorf("Unexpected clone output: %q", got)
+		}
+
+		buf, err = enc.EncodeEntry(zapcore.Entry{Message: "msg"}, nil)
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		if got := buf.String(); got != "info msg base=value\n" {
+			t.Errorf("Expected original to be unaffected by clone, got: %q", got)
+		}
+	})
+}
+
 func TestTextEncoderSpecialCases(t *testing.T) {
 	cfg := zap.NewProductionEncoderConfig()
 
@@ -436,16 +501,367 @@ func TestTextEncoderSpecialCases(t *testing.T) {
 		core := zapcore.NewCore(NewTextEncoder(cfg), zapcore.AddSync(&buf), zap.InfoLevel)
 		logger := zap.New(core)
 
-		// OpenNamespace is currently a no-op, but we should test it doesn't crash
 		logger.Info("test message", zap.Namespace("namespace"), zap.String("key", "value"))
 
 		output := buf.String()
-		if !strings.Contains(output, "key=value") {
-			t.Errorf("Expected key=value in output after OpenNamespace, got: %s", output)
+		if !strings.Contains(output, "namespace.key=value") {
+			t.Errorf("Expected namespace.key=value in output after OpenNamespace, got: %s", output)
 		}
 	})
 }
 
+func TestTextEncoderLevel(t *testing.T) {
+	entry := zapcore.Entry{Level: zap.WarnLevel, Message: "msg"}
+
+	tests := []struct {
+		name        string
+		encodeLevel zapcore.LevelEncoder
+		keyed       bool
+		expected    string
+	}{
+		{"Lowercase", zapcore.LowercaseLevelEncoder, false, "warn msg\n"},
+		{"Capital", zapcore.CapitalLevelEncoder, false, "WARN msg\n"},
+		{"Capital color", zapcore.CapitalColorLevelEncoder, false, "\x1b[33mWARN\x1b[0m msg\n"},
+		{"Custom", func(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+			enc.AppendString("[" + l.CapitalString()[:1] + "]")
+		}, false, "[W] msg\n"},
+		{"No encoder", nil, false, "WARN msg\n"},
+		{"No-op encoder", func(zapcore.Level, zapcore.PrimitiveArrayEncoder) {}, false, "WARN msg\n"},
+		{"Keyed lowercase", zapcore.LowercaseLevelEncoder, true, "level=warn msg\n"},
+		{"Keyed capital", zapcore.CapitalLevelEncoder, true, "level=WARN msg\n"},
+		{"Keyed no encoder", nil, true, "level=WARN msg\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := zapcore.EncoderConfig{LevelKey: "level", MessageKey: "msg", EncodeLevel: tt.encodeLevel}
+			enc := NewTextEncoder(cfg).(*TextEncoder)
+			enc.SetKeyedLevel(tt.keyed)
+
+			buf, err := enc.EncodeEntry(entry, nil)
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("Expected %q, got: %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTextEncoderCaller(t *testing.T) {
+	entry := zapcore.Entry{
+		Level:   zap.InfoLevel,
+		Message: "msg",
+		Caller: zapcore.EntryCaller{
+			Defined:  true,
+			File:     "/src/mono/services/api/handler.go",
+			Line:     42,
+			Function: "github.com/org/mono/services/api.Serve",
+		},
+	}
+
+	tests := []struct {
+		name         string
+		encodeCaller zapcore.CallerEncoder
+		functionKey  string
+		keyed        bool
+		expected     string
+	}{
+		{"Short", zapcore.ShortCallerEncoder, "", false, "INFO api/handler.go:42 msg\n"},
+		{"Full", zapcore.FullCallerEncoder, "", false, "INFO /src/mono/services/api/handler.go:42 msg\n"},
+		{"No encoder", nil, "", false, "INFO api/handler.go:42 msg\n"},
+		{"Module relative", ModuleCallerEncoderFactory("github.com/org/mono"), "", false, "INFO services/api/handler.go:42 msg\n"},
+		{"Function form", FunctionCallerEncoder, "", false, "INFO api.Serve:42 msg\n"},
+		{"With function", zapcore.ShortCallerEncoder, "func", false, "INFO api/handler.go:42 github.com/org/mono/services/api.Serve msg\n"},
+		{"Keyed", zapcore.ShortCallerEncoder, "", true, `INFO caller="api/handler.go:42" msg` + "\n"},
+		{"Keyed with function", FunctionCallerEncoder, "func", true, `INFO caller="api.Serve:42" func=github.com/org/mono/services/api.Serve msg` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := zapcore.EncoderConfig{
+				LevelKey:     "level",
+				CallerKey:    "caller",
+				FunctionKey:  tt.functionKey,
+				MessageKey:   "msg",
+				EncodeLevel:  zapcore.CapitalLevelEncoder,
+				EncodeCaller: tt.encodeCaller,
+			}
+			enc := NewTextEncoder(cfg).(*TextEncoder)
+			enc.SetKeyedCaller(tt.keyed)
+
+			buf, err := enc.EncodeEntry(entry, nil)
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("Expected %q, got: %q", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("Undefined caller is omitted", func(t *testing.T) {
+		cfg := zapcore.EncoderConfig{LevelKey: "level", CallerKey: "caller", FunctionKey: "func", MessageKey: "msg"}
+		buf, err := NewTextEncoder(cfg).EncodeEntry(zapcore.Entry{Message: "msg"}, nil)
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		if got := buf.String(); got != "INFO msg\n" {
+			t.Errorf("Expected %q, got: %q", "INFO msg\n", got)
+		}
+	})
+}
+
+func TestTextEncoderLoggerName(t *testing.T) {
+	tests := []struct {
+		name       string
+		nameKey    string
+		encodeName zapcore.NameEncoder
+		keyed      bool
+		expected   string
+	}{
+		{"Default encoder", "logger", nil, false, "INFO server.http msg\n"},
+		{"Abbreviated", "logger", AbbreviatedNameEncoder, false, "INFO s.http msg\n"},
+		{"Padded", "logger", PaddedNameEncoderFactory(14, nil), false, "INFO server.http    msg\n"},
+		{"Keyed", "logger", nil, true, "INFO logger=server.http msg\n"},
+		{"No name key", "", nil, false, "INFO msg\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := zapcore.EncoderConfig{LevelKey: "level", NameKey: tt.nameKey, MessageKey: "msg", EncodeName: tt.encodeName}
+			enc := NewTextEncoder(cfg).(*TextEncoder)
+			enc.SetKeyedName(tt.keyed)
+
+			var buf bytes.Buffer
+			logger := zap.New(zapcore.NewCore(enc, zapcore.AddSync(&buf), zap.InfoLevel))
+			logger.Named("server").Named("http").Info("msg")
+
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("Expected %q, got: %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTextEncoderLineEnding(t *testing.T) {
+	tests := []struct {
+		name           string
+		lineEnding     string
+		skipLineEnding bool
+		expected       string
+	}{
+		{"Default", "", false, "INFO msg key=value\n"},
+		{"CRLF", "\r\n", false, "INFO msg key=value\r\n"},
+		{"Custom", ";", false, "INFO msg key=value;"},
+		{"Skipped", "", true, "INFO msg key=value"},
+		{"Skipped overrides custom", "\r\n", true, "INFO msg key=value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := zapcore.EncoderConfig{
+				LevelKey:       "level",
+				MessageKey:     "msg",
+				LineEnding:     tt.lineEnding,
+				SkipLineEnding: tt.skipLineEnding,
+			}
+			enc := NewTextEncoder(cfg)
+
+			buf, err := enc.Clone().EncodeEntry(zapcore.Entry{Message: "msg"}, []zapcore.Field{zap.String("key", "value")})
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("Expected %q, got: %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTextEncoderNamespaces(t *testing.T) {
+	cfg := zap.NewProductionEncoderConfig()
+	cfg.TimeKey = ""
+
+	newLogger := func(buf *bytes.Buffer, nested bool) *zap.Logger {
+		enc := NewTextEncoder(cfg).(*TextEncoder)
+		enc.SetNestedNamespaces(nested)
+		return zap.New(zapcore.NewCore(enc, zapcore.AddSync(buf), zap.InfoLevel))
+	}
+
+	tests := []struct {
+		name     string
+		nested   bool
+		log      func(*zap.Logger)
+		expected string
+	}{
+		{
+			name: "Prefixed keys",
+			log: func(logger *zap.Logger) {
+				logger.Info("request", zap.String("id", "1"), zap.Namespace("http"), zap.String("method", "GET"), zap.Int("status", 200))
+			},
+			expected: "info request id=1 http.method=GET http.status=200",
+		},
+		{
+			name: "Prefixes nest across With",
+			log: func(logger *zap.Logger) {
+				logger.With(zap.Namespace("http")).With(zap.String("method", "GET"), zap.Namespace("req")).
+					Info("request", zap.Int("size", 10))
+			},
+			expected: "info request http.method=GET http.req.size=10",
+		},
+		{
+			name: "Objects start a fresh namespace scope",
+			log: func(logger *zap.Logger) {
+				obj := zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+					enc.AddString("a", "1")
+					enc.OpenNamespace("inner")
+					enc.AddString("b", "2")
+					return nil
+				})
+				logger.Info("request", zap.Namespace("http"), zap.Object("obj", obj), zap.String("after", "x"))
+			},
+			expected: "info request http.obj={a=1 inner.b=2} http.after=x",
+		},
+		{
+			name:   "Nested blocks",
+			nested: true,
+			log: func(logger *zap.Logger) {
+				logger.Info("request", zap.String("id", "1"), zap.Namespace("http"), zap.String("method", "GET"), zap.Int("status", 200))
+			},
+			expected: "info request id=1 http={method=GET status=200}",
+		},
+		{
+			name:   "Nested blocks across With",
+			nested: true,
+			log: func(logger *zap.Logger) {
+				child := logger.With(zap.Namespace("http"), zap.String("method", "GET"))
+				child.Info("request", zap.Namespace("resp"), zap.Int("status", 200))
+			},
+			expected: "info request http={method=GET resp={status=200}}",
+		},
+		{
+			name:   "Nested blocks inside objects are closed with the object",
+			nested: true,
+			log: func(logger *zap.Logger) {
+				obj := zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+					enc.OpenNamespace("inner")
+					enc.AddString("b", "2")
+					return nil
+				})
+				logger.Info("request", zap.Object("obj", obj), zap.String("after", "x"))
+			},
+			expected: "info request obj={inner={b=2}} after=x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(newLogger(&buf, tt.nested))
+
+			output := strings.TrimSpace(buf.String())
+			if output != tt.expected {
+				t.Errorf("Expected %q, got: %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestTextEncoderBraceSeparators(t *testing.T) {
+	cfg := zapcore.EncoderConfig{LevelKey: "level", MessageKey: "msg", EncodeLevel: zapcore.CapitalLevelEncoder}
+	empty := zapcore.ObjectMarshalerFunc(func(zapcore.ObjectEncoder) error { return nil })
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		message  string
+		fields   []zapcore.Field
+		expected string
+	}{
+		{
+			name:     "Message ending with a brace",
+			message:  "payload {",
+			fields:   []zapcore.Field{zap.String("user", "bob")},
+			expected: "INFO payload { user=bob",
+		},
+		{
+			name:     "Unquoted value ending with a brace",
+			opts:     []Option{WithQuotePolicy(QuoteNever)},
+			message:  "m",
+			fields:   []zapcore.Field{zap.String("a", "x{"), zap.String("user", "bob")},
+			expected: "INFO m a=x{ user=bob",
+		},
+		{
+			name:     "Empty object",
+			message:  "m",
+			fields:   []zapcore.Field{zap.Object("obj", empty), zap.String("user", "bob")},
+			expected: "INFO m obj={} user=bob",
+		},
+		{
+			name:     "Empty nested namespace",
+			opts:     []Option{WithNestedNamespaces(true)},
+			message:  "m",
+			fields:   []zapcore.Field{zap.Object("obj", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error { enc.OpenNamespace("ns"); return nil })), zap.String("user", "bob")},
+			expected: "INFO m obj={ns={}} user=bob",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewTextEncoderWithOptions(cfg, tt.opts...)
+			buf, err := enc.EncodeEntry(zapcore.Entry{Level: zapcore.InfoLevel, Message: tt.message}, tt.fields)
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			defer buf.Free()
+
+			if got := strings.TrimSpace(buf.String()); got != tt.expected {
+				t.Errorf("Expected %q, got: %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTextEncoderStringEscaping(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Plain", "plain", `plain`},
+		{"Unicode", "世界", `世界`},
+		{"Quote", `say "hi"`, `"say \"hi\""`},
+		{"Backslash in quoted value", `a b\c`, `"a b\\c"`},
+		{"Newline", "line1\nline2", `"line1\nline2"`},
+		{"Carriage return", "line1\rline2", `"line1\rline2"`},
+		{"Tab", "col1\tcol2", `"col1\tcol2"`},
+		{"Control characters", "test\x00\x01\x1f", `"test\u0000\u0001\u001f"`},
+		{"Escape sequence", "\x1b[31mred", `"\u001b[31mred"`},
+		{"Delete", "a\x7fb", "\"a\x7fb\""},
+		{"Invalid UTF-8", "bad\xffbyte", `"bad\ufffdbyte"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewTextEncoder(zapcore.EncoderConfig{})
+			buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{
+				zap.String("value", tt.input),
+				zap.Strings("values", []string{tt.input, "x"}),
+			})
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+
+			expected := "value=" + tt.expected + " values=[" + tt.expected + ",x]\n"
+			if got := buf.String(); got != expected {
+				t.Errorf("Expected %s, got: %s", expected, got)
+			}
+		})
+	}
+}
+
 func TestTextEncoderComplexTypes(t *testing.T) {
 	cfg := zap.NewProductionEncoderConfig()
 
@@ -497,6 +913,112 @@ func TestTextEncoderComplexTypes(t *testing.T) {
 	})
 }
 
+type testObject struct {
+	name  string
+	count int
+	tags  []string
+}
+
+func (o testObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", o.name)
+	enc.AddInt("count", o.count)
+	if o.tags != nil {
+		return enc.AddArray("tags", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			for _, tag := range o.tags {
+				arr.AppendString(tag)
+			}
+			return nil
+		}))
+	}
+	return nil
+}
+
+// testObjects is a zapcore.ArrayMarshaler of objects, like zap.Objects in
+// newer zap releases.
+type testObjects []testObject
+
+func (objs testObjects) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, obj := range objs {
+		if err := enc.AppendObject(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestTextEncoderNestedObjects(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    zapcore.Field
+		expected string
+	}{
+		{
+			name:     "Array of objects",
+			field:    zap.Array("objs", testObjects{{name: "a", count: 1}, {name: "b c", count: 2}}),
+			expected: `objs=[{name=a count=1},{name="b c" count=2}]`,
+		},
+		{
+			name:     "Objects with nested arrays",
+			field:    zap.Array("objs", testObjects{{name: "a", tags: []string{"x", "y"}}, {name: "b", tags: []string{}}}),
+			expected: `objs=[{name=a count=0 tags=[x,y]},{name=b count=0 tags=[]}]`,
+		},
+		{
+			name: "Object containing an array of objects",
+			field: zap.Object("outer", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+				enc.AddString("id", "1")
+				if err := enc.AddArray("children", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+					if err := arr.AppendObject(testObject{name: "c1"}); err != nil {
+						return err
+					}
+					return arr.AppendObject(zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+						return enc.AddObject("inner", testObject{name: "deep", count: 3})
+					}))
+				})); err != nil {
+					return err
+				}
+				enc.AddBool("ok", true)
+				return nil
+			})),
+			expected: `outer={id=1 children=[{name=c1 count=0},{inner={name=deep count=3}}] ok=true}`,
+		},
+		{
+			name: "Arrays of arrays of objects",
+			field: zap.Array("matrix", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+				for i := 0; i < 2; i++ {
+					if err := arr.AppendArray(zapcore.ArrayMarshalerFunc(func(inner zapcore.ArrayEncoder) error {
+						inner.AppendInt(i)
+						return inner.AppendObject(testObject{name: "n", count: i})
+					})); err != nil {
+						return err
+					}
+				}
+				return nil
+			})),
+			expected: `matrix=[[0,{name=n count=0}],[1,{name=n count=1}]]`,
+		},
+		{
+			name: "Empty object in array",
+			field: zap.Array("objs", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+				return arr.AppendObject(zapcore.ObjectMarshalerFunc(func(zapcore.ObjectEncoder) error { return nil }))
+			})),
+			expected: `objs=[{}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := NewTextEncoder(zapcore.EncoderConfig{}).EncodeEntry(zapcore.Entry{}, []zapcore.Field{tt.field, zap.Int("after", 1)})
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			expected := tt.expected + " after=1\n"
+			if got := buf.String(); got != expected {
+				t.Errorf("Expected %s, got: %s", expected, got)
+			}
+		})
+	}
+}
+
 func TestTextEncoderReflectedValues(t *testing.T) {
 	cfg := zap.NewProductionEncoderConfig()
 
@@ -525,6 +1047,98 @@ func TestTextEncoderReflectedValues(t *testing.T) {
 	})
 }
 
+func TestTextEncoderReflectedCompositeValues(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+	}
+	type user struct {
+		Name    string   `json:"name"`
+		Tags    []string `json:"tags"`
+		Address address  `json:"address"`
+	}
+	type node struct {
+		Next *node `json:"next"`
+	}
+	selfMap := map[string]any{"name": "m"}
+	selfMap["self"] = selfMap
+
+	tests := []struct {
+		name     string
+		value    any
+		expected string
+	}{
+		{"Struct", user{Name: "bob", Tags: []string{"a"}, Address: address{City: "Paris"}}, `user={"name":"bob","tags":["a"],"address":{"city":"Paris"}}`},
+		{"Map", map[string]int{"b": 2, "a": 1}, `user={"a":1,"b":2}`},
+		{"Slice", []int{1, 2, 3}, `user=[1,2,3]`},
+		{"String with spaces", "hello world", `user="hello world"`},
+		{"Cycle", selfMap, `user={"name":"m","self":"<cycle>"}`},
+		{"Map keys are escaped", map[string]int{"x\ny": 1}, `user={"x\ny":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := NewTextEncoder(zapcore.EncoderConfig{}).EncodeEntry(zapcore.Entry{}, []zapcore.Field{zap.Any("user", tt.value)})
+			if err != nil {
+				t.Fatalf("EncodeEntry failed: %v", err)
+			}
+			if got := strings.TrimSpace(buf.String()); got != tt.expected {
+				t.Errorf("Expected %s, got: %s", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("Encoding errors are reported as a field", func(t *testing.T) {
+		root := &node{}
+		for i, cur := 0, root; i < 40; i++ {
+			cur.Next = &node{}
+			cur = cur.Next
+		}
+
+		buf, err := NewTextEncoder(zapcore.EncoderConfig{}).EncodeEntry(zapcore.Entry{}, []zapcore.Field{
+			zap.Reflect("chain", root),
+			zap.Int("after", 1),
+		})
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		output := buf.String()
+		if !strings.HasPrefix(output, `chainError="maximum encoding depth exceeded: 32" after=1`) {
+			t.Errorf("Expected chainError field without partial output, got: %s", output)
+		}
+	})
+
+	t.Run("Marshaler panics are reported as a field", func(t *testing.T) {
+		buf, err := NewTextEncoder(zapcore.EncoderConfig{}).EncodeEntry(zapcore.Entry{}, []zapcore.Field{
+			zap.Reflect("levels", []marshalLevel{1, 2}),
+			zap.Reflect("ip", net.IPv4(10, 0, 0, 1)),
+		})
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		expected := `levelsError="panic calling String for type zaptext_test.marshalLevel: unknown level" ip="10.0.0.1"`
+		if got := strings.TrimSpace(buf.String()); got != expected {
+			t.Errorf("Expected %s, got: %s", expected, got)
+		}
+	})
+
+	t.Run("AppendReflected inside arrays", func(t *testing.T) {
+		arr := zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
+			if err := enc.AppendReflected(address{City: "Rome"}); err != nil {
+				return err
+			}
+			return enc.AppendReflected("two words")
+		})
+
+		buf, err := NewTextEncoder(zapcore.EncoderConfig{}).EncodeEntry(zapcore.Entry{}, []zapcore.Field{zap.Array("items", arr)})
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+		if got, expected := strings.TrimSpace(buf.String()), `items=[{"city":"Rome"},"two words"]`; got != expected {
+			t.Errorf("Expected %s, got: %s", expected, got)
+		}
+	})
+}
+
 func TestTextEncoderByteHandling(t *testing.T) {
 	cfg := zap.NewProductionEncoderConfig()
 